@@ -3,9 +3,12 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 
@@ -13,6 +16,7 @@ import (
 	"github.com/docker/docker/client"
 	"github.com/draganm/go-reactor"
 	"github.com/netice9/apparatchik/core"
+	"github.com/netice9/apparatchik/core/logstore"
 	"github.com/netice9/apparatchik/public"
 	"github.com/netice9/apparatchik/ui"
 	"github.com/urfave/negroni"
@@ -59,11 +63,33 @@ func startHttpServer(apparatchick *core.Apparatchik, dockerClient *client.Client
 	router.PUT("/api/v1.0/applications/:applicationName", api.CreateApplication)
 	router.DELETE("/api/v1.0/applications/:applicationName", api.DeleteApplication)
 
+	router.POST("/api/v1.0/applications/:applicationName/plan", api.PlanApplication)
+	router.POST("/api/v1.0/applications/:applicationName/stop", api.StopApplication)
+	router.POST("/api/v1.0/applications/:applicationName/start", api.StartApplication)
+	router.GET("/api/v1.0/applications/:applicationName/revisions", api.GetRevisions)
+	router.POST("/api/v1.0/applications/:applicationName/revisions/:revision/rollback", api.RollbackApplication)
+
 	router.GET("/api/v1.0/applications", api.GetApplications)
+	router.GET("/api/v1.0/logs/search", api.SearchLogs)
+	router.GET("/api/v1.0/events", api.GetEvents)
 	router.GET("/api/v1.0/applications/:applicationName", api.GetApplication)
+	router.GET("/api/v1.0/applications/:applicationName/events", api.GetEvents)
 
 	router.GET("/api/v1.0/applications/:applicationName/goals/:goalName/inspect", api.GetGoalInspect)
 	router.GET("/api/v1.0/applications/:applicationName/goals/:goalName/exec", api.ExecSocket)
+	router.GET("/api/v1.0/applications/:applicationName/goals/:goalName/transition_log", api.GetGoalTransitionLog)
+	router.GET("/api/v1.0/applications/:applicationName/goals/:goalName/stats", api.GetGoalStats)
+	router.GET("/api/v1.0/applications/:applicationName/goals/:goalName/current_stats", api.GetGoalCurrentStats)
+	router.GET("/api/v1.0/applications/:applicationName/goals/:goalName/logs", api.GetGoalLogs)
+	router.GET("/api/v1.0/applications/:applicationName/goals/:goalName/runs", api.GetGoalRuns)
+	router.GET("/api/v1.0/applications/:applicationName/goals/:goalName/runs/:containerID/logs", api.GetGoalRunLogs)
+	router.POST("/api/v1.0/applications/:applicationName/goals/:goalName/start", api.GoalAction(200, (*core.Application).StartGoal))
+	router.POST("/api/v1.0/applications/:applicationName/goals/:goalName/stop", api.GoalAction(202, (*core.Application).StopGoal))
+	router.POST("/api/v1.0/applications/:applicationName/goals/:goalName/restart", api.GoalAction(202, (*core.Application).RestartGoal))
+	router.POST("/api/v1.0/applications/:applicationName/goals/:goalName/kill", api.GoalAction(202, (*core.Application).KillGoal))
+	router.POST("/api/v1.0/applications/:applicationName/goals/:goalName/pull", api.GoalAction(202, (*core.Application).PullGoal))
+	router.POST("/api/v1.0/applications/:applicationName/goals/:goalName/pause", api.GoalAction(200, (*core.Application).PauseGoal))
+	router.POST("/api/v1.0/applications/:applicationName/goals/:goalName/unpause", api.GoalAction(200, (*core.Application).UnpauseGoal))
 
 	reactor := reactor.New(negroni.HandlerFunc(healthckeckMiddleware), NewAuthHandler(), negroni.NewStatic(public.AssetFS()), &negroniHTTPRouter{router})
 
@@ -77,6 +103,16 @@ func startHttpServer(apparatchick *core.Apparatchik, dockerClient *client.Client
 		return err
 	}
 
+	err = reactor.AddScreen("/search", ui.SearchFactory)
+	if err != nil {
+		return err
+	}
+
+	err = reactor.AddScreen("/search/:application", ui.SearchFactory)
+	if err != nil {
+		return err
+	}
+
 	err = reactor.AddScreen("/apps/:application", ui.ApplicationFactory)
 	if err != nil {
 		return err
@@ -286,12 +322,350 @@ func (a *API) GetGoalInspect(w http.ResponseWriter, r *http.Request, ps httprout
 
 }
 
+func (a *API) GetGoalTransitionLog(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	applicationName := ps.ByName("applicationName")
+	goalName := ps.ByName("goalName")
+
+	application, err := a.apparatchick.ApplicationByName(applicationName)
+
+	if err != nil {
+		respondWithError(err, w)
+		return
+	}
+
+	transitionLog, err := application.TransitionLog(goalName)
+
+	if err != nil {
+		respondWithError(err, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	if err := json.NewEncoder(w).Encode(transitionLog); err != nil {
+		panic(err)
+	}
+
+}
+
+// GetGoalStats writes resource usage of the goal sampled after the since
+// parameter, or all kept samples without it.
+func (a *API) GetGoalStats(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	applicationName := ps.ByName("applicationName")
+	goalName := ps.ByName("goalName")
+
+	since, err := core.ParseLogTime(r.URL.Query().Get("since"), time.Now())
+	if err != nil {
+		respondWithStatus(400, fmt.Errorf("Invalid since %q", r.URL.Query().Get("since")), w)
+		return
+	}
+
+	application, err := a.apparatchick.ApplicationByName(applicationName)
+
+	if err != nil {
+		respondWithError(err, w)
+		return
+	}
+
+	entries, err := application.GoalStats(goalName, since)
+
+	if err != nil {
+		respondWithError(err, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		panic(err)
+	}
+
+}
+
+// GetGoalCurrentStats writes the last resource usage of the goal as reported
+// by Docker.
+func (a *API) GetGoalCurrentStats(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	applicationName := ps.ByName("applicationName")
+	goalName := ps.ByName("goalName")
+
+	application, err := a.apparatchick.ApplicationByName(applicationName)
+
+	if err != nil {
+		respondWithError(err, w)
+		return
+	}
+
+	currentStats, err := application.GoalCurrentStats(goalName)
+
+	if err != nil {
+		respondWithError(err, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	if err := json.NewEncoder(w).Encode(currentStats); err != nil {
+		panic(err)
+	}
+
+}
+
+// GetGoalLogs writes output of the goal as plain text. When following, every
+// line is flushed to the client as soon as it has been read.
+func (a *API) GetGoalLogs(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	applicationName := ps.ByName("applicationName")
+	goalName := ps.ByName("goalName")
+
+	query := r.URL.Query()
+
+	options := core.LogOptions{
+		Since: query.Get("since"),
+		Until: query.Get("until"),
+		Tail:  query.Get("tail"),
+	}
+
+	var timestamps bool
+	var err error
+
+	for _, param := range []struct {
+		name  string
+		value *bool
+		def   bool
+	}{
+		{"stdout", &options.Stdout, true},
+		{"stderr", &options.Stderr, true},
+		{"follow", &options.Follow, false},
+		{"timestamps", &timestamps, false},
+	} {
+		*param.value, err = queryBool(query.Get(param.name), param.def)
+		if err != nil {
+			respondWithStatus(400, fmt.Errorf("Invalid %s %q", param.name, query.Get(param.name)), w)
+			return
+		}
+	}
+
+	err = options.Validate()
+	if err != nil {
+		respondWithStatus(400, err, w)
+		return
+	}
+
+	application, err := a.apparatchick.ApplicationByName(applicationName)
+	if err != nil {
+		respondWithError(err, w)
+		return
+	}
+
+	stream, err := application.OpenLogs(r.Context(), goalName, options)
+	if err != nil {
+		respondWithError(err, w)
+		return
+	}
+	defer stream.Close()
+
+	flusher, _ := w.(http.Flusher)
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(200)
+
+	for {
+		line, err := stream.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			log.Error("Reading logs of goal ", goalName, " of application ", applicationName, ": ", err)
+			return
+		}
+		_, err = io.WriteString(w, line.Format(timestamps))
+		if err != nil {
+			return
+		}
+		if options.Follow && flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// GetGoalRuns lists stored runs of the goal. Runs are kept after the goal
+// or its application has been removed.
+func (a *API) GetGoalRuns(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	runs := []logstore.Run{}
+
+	if core.LogStore != nil {
+		var err error
+		runs, err = core.LogStore.Runs(ps.ByName("applicationName"), ps.ByName("goalName"))
+		if err != nil {
+			respondWithStatus(400, err, w)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	if err := json.NewEncoder(w).Encode(runs); err != nil {
+		panic(err)
+	}
+}
+
+// GetGoalRunLogs writes stored output of a run of the goal as plain text.
+func (a *API) GetGoalRunLogs(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	query := r.URL.Query()
+
+	var stdout, stderr, timestamps bool
+	var err error
+
+	for _, param := range []struct {
+		name  string
+		value *bool
+		def   bool
+	}{
+		{"stdout", &stdout, true},
+		{"stderr", &stderr, true},
+		{"timestamps", &timestamps, false},
+	} {
+		*param.value, err = queryBool(query.Get(param.name), param.def)
+		if err != nil {
+			respondWithStatus(400, fmt.Errorf("Invalid %s %q", param.name, query.Get(param.name)), w)
+			return
+		}
+	}
+
+	tail := -1
+	if value := query.Get("tail"); value != "" && value != "all" {
+		tail, err = strconv.Atoi(value)
+		if err != nil || tail < 0 {
+			respondWithStatus(400, fmt.Errorf("Invalid tail %q", value), w)
+			return
+		}
+	}
+
+	if core.LogStore == nil {
+		respondWithError(logstore.ErrRunNotFound, w)
+		return
+	}
+
+	lines := []string{}
+	err = core.LogStore.ReadRun(ps.ByName("applicationName"), ps.ByName("goalName"), ps.ByName("containerID"), func(line logstore.Line) error {
+		if (line.Stream == core.StreamStdout && !stdout) || (line.Stream == core.StreamStderr && !stderr) {
+			return nil
+		}
+		lines = append(lines, core.LogLine(line).Format(timestamps))
+		if tail >= 0 && len(lines) > tail {
+			lines = lines[len(lines)-tail:]
+		}
+		return nil
+	})
+	if err != nil {
+		respondWithError(err, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(200)
+	for _, line := range lines {
+		_, err = io.WriteString(w, line)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Limits of the context and the number of lines returned by a search.
+const (
+	maxSearchContext = 20
+	maxSearchLimit   = 1000
+)
+
+// SearchResponse lists lines of stored output matching a search.
+type SearchResponse struct {
+	Matches   []logstore.Match `json:"matches"`
+	Truncated bool             `json:"truncated"`
+}
+
+// SearchLogs searches stored output of all goals for lines containing q.
+func (a *API) SearchLogs(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	query := r.URL.Query()
+
+	search := logstore.Query{
+		Text:        query.Get("q"),
+		Application: query.Get("app"),
+		Goal:        query.Get("goal"),
+		Context:     logstore.DefaultSearchContext,
+		Limit:       logstore.DefaultSearchLimit,
+	}
+
+	if search.Text == "" {
+		respondWithStatus(400, errors.New("Query q is required"), w)
+		return
+	}
+
+	since, err := core.ParseLogTime(query.Get("since"), time.Now())
+	if err != nil {
+		respondWithStatus(400, fmt.Errorf("Invalid since %q", query.Get("since")), w)
+		return
+	}
+	search.Since = since
+
+	for _, param := range []struct {
+		name  string
+		value *int
+		max   int
+	}{
+		{"context", &search.Context, maxSearchContext},
+		{"limit", &search.Limit, maxSearchLimit},
+	} {
+		value := query.Get(param.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > param.max {
+			respondWithStatus(400, fmt.Errorf("Invalid %s %q", param.name, value), w)
+			return
+		}
+		*param.value = n
+	}
+
+	response := SearchResponse{Matches: []logstore.Match{}}
+
+	if core.LogStore != nil {
+		response.Matches, response.Truncated, err = core.LogStore.Search(search)
+		if err != nil {
+			respondWithError(err, w)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		panic(err)
+	}
+}
+
+// queryBool parses a boolean query parameter, returning def when it is not
+// set.
+func queryBool(value string, def bool) (bool, error) {
+	if value == "" {
+		return def, nil
+	}
+	return strconv.ParseBool(value)
+}
+
 func (a *API) CreateApplication(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	applicationName := ps.ByName("applicationName")
+
+	wait, err := parseWait(r)
+	if err != nil {
+		respondWithStatus(400, err, w)
+		return
+	}
+
 	decoder := json.NewDecoder(r.Body)
 
 	var applicationConfiguration core.ApplicationConfiguration
-	err := decoder.Decode(&applicationConfiguration)
+	err = decoder.Decode(&applicationConfiguration)
 
 	if err != nil {
 		respondWithError(err, w)
@@ -305,8 +679,24 @@ func (a *API) CreateApplication(w http.ResponseWriter, r *http.Request, ps httpr
 		return
 	}
 
-	status, err := a.apparatchick.NewApplication(applicationName, &applicationConfiguration)
+	user, _, _ := r.BasicAuth()
+
+	waiter := a.apparatchick.WatchApplication(applicationName)
+	defer waiter.Close()
+
+	status, err := a.apparatchick.NewApplication(applicationName, &applicationConfiguration, user)
+
+	if err == core.ErrApplicationAlreadyExists {
+		a.updateApplication(w, applicationName, &applicationConfiguration, user, waiter, wait)
+		return
+	}
+
+	if err != nil {
+		respondWithError(err, w)
+		return
+	}
 
+	status, code, err := waitForApplication(waiter, wait, nil, status, 201)
 	if err != nil {
 		respondWithError(err, w)
 		return
@@ -314,23 +704,255 @@ func (a *API) CreateApplication(w http.ResponseWriter, r *http.Request, ps httpr
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Location", fmt.Sprintf("/api/v1.0/applications/%s", applicationName))
-	w.WriteHeader(201)
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		panic(err)
+	}
+
+}
+
+// parseWait reads the wait parameter, the longest time to wait for the
+// application to settle. Zero means that the request doesn't wait.
+func parseWait(r *http.Request) (time.Duration, error) {
+	value := r.URL.Query().Get("wait")
+	if value == "" {
+		return 0, nil
+	}
+	wait, err := time.ParseDuration(value)
+	if err != nil || wait < 0 || wait > core.MaxWait {
+		return 0, fmt.Errorf("Invalid wait %q, has to be a duration up to %s", value, core.MaxWait)
+	}
+	return wait, nil
+}
+
+// waitForApplication waits for the application to settle when wait is set
+// and returns its status then with the code of the response: code when the
+// goals needed by the main goal are running or terminated, 422 when one of
+// them failed and 202 when the application didn't settle in time. changed
+// are goals recreated or added by the request.
+func waitForApplication(waiter *core.ApplicationWaiter, wait time.Duration, changed []string, status core.ApplicationStatus, code int) (core.ApplicationStatus, int, error) {
+	if wait == 0 {
+		return status, code, nil
+	}
+
+	status, result, err := waiter.Wait(changed, wait)
+	if err != nil {
+		return status, 0, err
+	}
+
+	switch result {
+	case core.WaitFailed:
+		return status, 422, nil
+	case core.WaitTimedOut:
+		return status, 202, nil
+	}
+	return status, code, nil
+}
+
+func (a *API) PlanApplication(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	applicationName := ps.ByName("applicationName")
+
+	var applicationConfiguration core.ApplicationConfiguration
+	err := json.NewDecoder(r.Body).Decode(&applicationConfiguration)
+
+	if err != nil {
+		respondWithStatus(400, err, w)
+		return
+	}
+
+	plan, err := a.apparatchick.PlanApplication(applicationName, &applicationConfiguration)
+
+	if err == core.ErrInvalidApplicationName || err == core.ErrVolumeChanged {
+		respondWithError(err, w)
+		return
+	}
+
+	if err != nil {
+		respondWithStatus(422, err, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	if err := json.NewEncoder(w).Encode(plan); err != nil {
+		panic(err)
+	}
+}
+
+func (a *API) updateApplication(w http.ResponseWriter, applicationName string, applicationConfiguration *core.ApplicationConfiguration, user string, waiter *core.ApplicationWaiter, wait time.Duration) {
+	status, err := a.apparatchick.UpdateApplication(applicationName, applicationConfiguration, user)
+
+	if err != nil {
+		respondWithError(err, w)
+		return
+	}
+
+	a.respondWithUpdateStatus(w, status, waiter, wait)
+}
+
+func (a *API) respondWithUpdateStatus(w http.ResponseWriter, status core.ApplicationUpdateStatus, waiter *core.ApplicationWaiter, wait time.Duration) {
+	changed := append(append([]string{}, status.Recreated...), status.Added...)
+	applicationStatus, code, err := waitForApplication(waiter, wait, changed, status.ApplicationStatus, 200)
+	if err != nil {
+		respondWithError(err, w)
+		return
+	}
+	status.ApplicationStatus = applicationStatus
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		panic(err)
+	}
+}
+
+func (a *API) StopApplication(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	applicationName := ps.ByName("applicationName")
+
+	status, err := a.apparatchick.StopApplication(applicationName)
+
+	if err != nil {
+		respondWithError(err, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(202)
 
 	if err := json.NewEncoder(w).Encode(status); err != nil {
 		panic(err)
 	}
+}
+
+func (a *API) StartApplication(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	applicationName := ps.ByName("applicationName")
+
+	wait, err := parseWait(r)
+	if err != nil {
+		respondWithStatus(400, err, w)
+		return
+	}
+
+	waiter := a.apparatchick.WatchApplication(applicationName)
+	defer waiter.Close()
+
+	status, err := a.apparatchick.StartApplication(applicationName)
+
+	if err != nil {
+		respondWithError(err, w)
+		return
+	}
+
+	status, code, err := waitForApplication(waiter, wait, nil, status, 200)
+	if err != nil {
+		respondWithError(err, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		panic(err)
+	}
+}
+
+func (a *API) GetRevisions(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	applicationName := ps.ByName("applicationName")
+
+	revisions, err := a.apparatchick.Revisions(applicationName)
+
+	if err != nil {
+		respondWithError(err, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	if err := json.NewEncoder(w).Encode(revisions); err != nil {
+		panic(err)
+	}
+}
+
+func (a *API) RollbackApplication(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	applicationName := ps.ByName("applicationName")
+
+	number, err := strconv.Atoi(ps.ByName("revision"))
+	if err != nil {
+		respondWithError(core.ErrRevisionNotFound, w)
+		return
+	}
+
+	wait, err := parseWait(r)
+	if err != nil {
+		respondWithStatus(400, err, w)
+		return
+	}
 
+	user, _, _ := r.BasicAuth()
+
+	waiter := a.apparatchick.WatchApplication(applicationName)
+	defer waiter.Close()
+
+	status, err := a.apparatchick.RollbackApplication(applicationName, number, user)
+
+	if err != nil {
+		respondWithError(err, w)
+		return
+	}
+
+	a.respondWithUpdateStatus(w, status, waiter, wait)
+}
+
+// GoalAction returns a handler performing the action on a single goal and
+// responding with the status of the goal.
+func (a *API) GoalAction(code int, action func(application *core.Application, goalName string) (core.GoalStatus, error)) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		applicationName := ps.ByName("applicationName")
+		goalName := ps.ByName("goalName")
+
+		application, err := a.apparatchick.ApplicationByName(applicationName)
+
+		if err != nil {
+			respondWithError(err, w)
+			return
+		}
+
+		status, err := action(application, goalName)
+
+		if err != nil {
+			respondWithError(err, w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			panic(err)
+		}
+	}
 }
 
 func respondWithError(err error, w http.ResponseWriter) {
 	code := 500
-	if err == core.ErrApplicationNotFound || err == core.ErrGoalNotFound {
+	if err == core.ErrApplicationNotFound || err == core.ErrGoalNotFound || err == core.ErrRevisionNotFound || err == core.ErrGoalHasNoContainer || err == core.ErrGoalHasNoStats || err == logstore.ErrRunNotFound {
 		code = 404
-	} else if err == core.ErrApplicationAlreadyExists {
+	} else if err == core.ErrApplicationAlreadyExists || err == core.ErrGoalNotRunning || err == core.ErrGoalNotPaused || err == core.ErrGoalNotInError || err == core.ErrVolumeChanged {
 		code = 409
+	} else if err == core.ErrInvalidApplicationName {
+		code = 400
 	}
-	w.WriteHeader(code)
+	respondWithStatus(code, err, w)
+}
+
+func respondWithStatus(code int, err error, w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
 	e := ErrorResponse{Reason: err.Error()}
 	if err := json.NewEncoder(w).Encode(e); err != nil {
 		panic(err)
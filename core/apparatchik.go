@@ -3,9 +3,12 @@ package core
 import (
 	"context"
 	"errors"
+	"fmt"
+	"os"
 	"sort"
 	"sync"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/draganm/emission"
 
 	"github.com/docker/docker/api/types"
@@ -19,34 +22,83 @@ type Apparatchik struct {
 	sync.Mutex
 	applications map[string]*Application
 	dockerClient *client.Client
+	store        StateStore
+	// stateLock serializes saving of application states, so that an older
+	// state never overwrites a newer one.
+	stateLock sync.Mutex
+	events    *EventHub
 	*emission.Emitter
 }
 
-func StartApparatchik(dockerClient *client.Client) (*Apparatchik, error) {
+func StartApparatchik(dockerClient *client.Client, store StateStore) (*Apparatchik, error) {
 
 	ch, _ := dockerClient.Events(context.Background(), types.EventsOptions{})
 
 	apparatchick := &Apparatchik{
 		applications: map[string]*Application{},
 		dockerClient: dockerClient,
+		store:        store,
 		// dockerEventsChannel: dockerEventsChannel,
+		events:  NewEventHub(),
 		Emitter: emission.NewEmitter(),
 	}
 
 	apparatchick.Emitter.SetMaxListeners(MaxListeners)
 
+	err := apparatchick.restoreApplications()
+	if err != nil {
+		return nil, err
+	}
+
 	go func() {
 		for evt := range ch {
 			apparatchick.HandleDockerEvent(evt)
 		}
 	}()
 
-	apparatchick.Emitter.EmitAsync("applications", apparatchick.applicatioNames())
+	apparatchick.emitApplications()
 
 	return apparatchick, nil
 
 }
 
+// restoreApplications re-creates all applications persisted in the state
+// store by a previous apparatchik process.
+func (a *Apparatchik) restoreApplications() error {
+	configs, err := a.store.LoadApplications()
+	if err != nil {
+		return err
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	for applicationName, config := range configs {
+		config.resolveRelativeVolumes(wd)
+
+		// descriptors were valid when they were stored, an application is
+		// restored even if they don't pass validation of this version, so
+		// that its containers are not abandoned
+		err = config.Validate()
+		if err != nil {
+			log.Warn("Descriptor of application ", applicationName, " is not valid any more: ", err)
+		}
+
+		state, err := a.store.LoadState(applicationName)
+		if err != nil {
+			log.Error("Could not load state of application ", applicationName, ": ", err)
+		}
+
+		application := RestoreApplication(applicationName, config, state, a.dockerClient, a.events)
+		a.watchState(applicationName, application)
+		a.applications[applicationName] = application
+	}
+
+	return nil
+}
+
 func (a *Apparatchik) GetApplicationByName(name string) (*Application, error) {
 	a.Lock()
 	defer a.Unlock()
@@ -57,7 +109,11 @@ func (a *Apparatchik) GetApplicationByName(name string) (*Application, error) {
 	return app, nil
 }
 
+// Stop terminates all applications. Their stored descriptors are kept, so
+// that they are deployed again when apparatchik is started.
 func (a *Apparatchik) Stop() {
+	a.stateLock.Lock()
+	defer a.stateLock.Unlock()
 	a.Lock()
 	defer a.Unlock()
 	for _, application := range a.applications {
@@ -66,6 +122,46 @@ func (a *Apparatchik) Stop() {
 	a.applications = map[string]*Application{}
 }
 
+func (a *Apparatchik) emitApplications() {
+	names := a.applicatioNames()
+	a.EmitAsync("applications", names)
+	a.events.Publish(Event{Type: EventApplications, Data: names})
+}
+
+// SubscribeEvents subscribes to events of all applications and goals
+// matching the filter, see EventHub.Subscribe.
+func (a *Apparatchik) SubscribeEvents(filter EventFilter, resume bool, lastEventID string) *EventSubscription {
+	return a.events.Subscribe(filter, resume, lastEventID)
+}
+
+// watchState saves the state of the application whenever one of its goals
+// changes its status.
+func (a *Apparatchik) watchState(name string, application *Application) {
+	application.On("transition", func(goalName string) {
+		err := a.saveState(name, application)
+		if err != nil {
+			log.Error("Could not save state of application ", name, ": ", err)
+		}
+	})
+}
+
+// saveState persists the runtime state of the application, unless the
+// application has been deleted in the meantime.
+func (a *Apparatchik) saveState(name string, application *Application) error {
+	a.stateLock.Lock()
+	defer a.stateLock.Unlock()
+
+	a.Lock()
+	current, found := a.applications[name]
+	a.Unlock()
+
+	if !found || current != application {
+		return nil
+	}
+
+	return a.store.SaveState(name, application.State())
+}
+
 func (a *Apparatchik) HandleDockerEvent(evt events.Message) {
 	a.Lock()
 	defer a.Unlock()
@@ -96,7 +192,14 @@ func (a *Apparatchik) GetContainerIDForGoal(applicatioName, goalName string) (*s
 	return goal.ContainerId, nil
 }
 
-func (a *Apparatchik) NewApplication(name string, config *ApplicationConfiguration) (ApplicationStatus, error) {
+// NewApplication deploys a new application. user is the name of the user
+// deploying the application, recorded in the revision history.
+func (a *Apparatchik) NewApplication(name string, config *ApplicationConfiguration, user string) (ApplicationStatus, error) {
+
+	err := ValidateApplicationName(name)
+	if err != nil {
+		return ApplicationStatus{}, err
+	}
 
 	a.Lock()
 	defer a.Unlock()
@@ -107,32 +210,171 @@ func (a *Apparatchik) NewApplication(name string, config *ApplicationConfigurati
 		return ApplicationStatus{}, ErrApplicationAlreadyExists
 	}
 
-	application := NewApplication(name, config, a.dockerClient)
+	_, err = a.store.SaveApplication(name, config, user)
+	if err != nil {
+		return ApplicationStatus{}, fmt.Errorf("Could not save application %q: %s", name, err.Error())
+	}
+
+	application := NewApplication(name, config, a.dockerClient, a.events)
+	a.watchState(name, application)
 	a.applications[name] = application
 
-	a.EmitAsync("applications", a.applicatioNames())
+	a.emitApplications()
+
+	return application.Status(), nil
+}
+
+// UpdateApplication replaces configuration of an existing application,
+// recreating only the goals that have changed.
+func (a *Apparatchik) UpdateApplication(name string, config *ApplicationConfiguration, user string) (ApplicationUpdateStatus, error) {
+
+	a.Lock()
+
+	application, found := a.applications[name]
+
+	if !found {
+		a.Unlock()
+		return ApplicationUpdateStatus{}, ErrApplicationNotFound
+	}
+
+	application.Lock()
+	err := application.Configuration.checkVolumeChanges(config)
+	application.Unlock()
+	if err != nil {
+		a.Unlock()
+		return ApplicationUpdateStatus{}, err
+	}
+
+	revision, err := a.store.SaveApplication(name, config, user)
+	if err != nil {
+		a.Unlock()
+		return ApplicationUpdateStatus{}, fmt.Errorf("Could not save application %q: %s", name, err.Error())
+	}
+
+	a.Unlock()
+
+	diff := application.Update(config)
+
+	return ApplicationUpdateStatus{
+		ApplicationStatus: application.Status(),
+		ConfigurationDiff: diff,
+		Revision:          revision.Number,
+	}, nil
+}
+
+// StopApplication gracefully stops all goals of the application in the
+// background. The application stays deployed and stays stopped after
+// apparatchik is restarted.
+func (a *Apparatchik) StopApplication(name string) (ApplicationStatus, error) {
+	application, err := a.ApplicationByName(name)
+	if err != nil {
+		return ApplicationStatus{}, err
+	}
+
+	application.setStopped(true)
+
+	err = a.saveState(name, application)
+	if err != nil {
+		return ApplicationStatus{}, fmt.Errorf("Could not save state of application %q: %s", name, err.Error())
+	}
+
+	go application.stopGoals()
+
+	return application.Status(), nil
+}
+
+// StartApplication starts a stopped application.
+func (a *Apparatchik) StartApplication(name string) (ApplicationStatus, error) {
+	application, err := a.ApplicationByName(name)
+	if err != nil {
+		return ApplicationStatus{}, err
+	}
+
+	application.setStopped(false)
+
+	err = a.saveState(name, application)
+	if err != nil {
+		return ApplicationStatus{}, fmt.Errorf("Could not save state of application %q: %s", name, err.Error())
+	}
+
+	application.Start()
 
 	return application.Status(), nil
 }
 
+// Revisions returns all stored revisions of the application descriptor.
+func (a *Apparatchik) Revisions(name string) ([]Revision, error) {
+	_, err := a.ApplicationByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return a.store.Revisions(name)
+}
+
+// RollbackApplication redeploys an older revision of the application
+// descriptor. The redeployed descriptor is stored as a new revision.
+func (a *Apparatchik) RollbackApplication(name string, number int, user string) (ApplicationUpdateStatus, error) {
+	_, err := a.ApplicationByName(name)
+	if err != nil {
+		return ApplicationUpdateStatus{}, err
+	}
+
+	revision, err := a.store.Revision(name, number)
+	if err != nil {
+		return ApplicationUpdateStatus{}, err
+	}
+
+	err = revision.Configuration.Validate()
+	if err != nil {
+		return ApplicationUpdateStatus{}, err
+	}
+
+	return a.UpdateApplication(name, revision.Configuration, user)
+}
+
+// PlanApplication describes what deploying the configuration would do,
+// including differences to the already deployed application of the same name.
+func (a *Apparatchik) PlanApplication(name string, config *ApplicationConfiguration) (ApplicationPlan, error) {
+	var current *ApplicationConfiguration
+
+	application, err := a.ApplicationByName(name)
+	if err == nil {
+		application.Lock()
+		current = application.Configuration
+		application.Unlock()
+	}
+
+	return NewApplicationPlan(name, config, current)
+}
+
 func (a *Apparatchik) TerminateApplication(applicationName string) error {
 
+	a.stateLock.Lock()
 	a.Lock()
 
 	application, found := a.applications[applicationName]
 
 	if !found {
 		a.Unlock()
+		a.stateLock.Unlock()
 		return ErrApplicationNotFound
 	}
 
+	err := a.store.DeleteApplication(applicationName)
+	if err != nil {
+		a.Unlock()
+		a.stateLock.Unlock()
+		return fmt.Errorf("Could not delete application %q: %s", applicationName, err.Error())
+	}
+
 	delete(a.applications, applicationName)
 
 	a.Unlock()
+	a.stateLock.Unlock()
 
 	application.TerminateApplication()
 
-	a.EmitAsync("applications", a.applicatioNames())
+	a.emitApplications()
 
 	return nil
 }
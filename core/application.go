@@ -2,17 +2,16 @@ package core
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
-	"io/ioutil"
-	"os"
 	"sync"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/client"
 	"github.com/draganm/emission"
+	"github.com/netice9/apparatchik/core/stats"
 )
 
 const MaxListeners = 500
@@ -21,55 +20,96 @@ var (
 	ErrApplicationAlreadyExists = errors.New("Application already exists")
 	ErrApplicationNotFound      = errors.New("Application not found")
 	ErrGoalNotFound             = errors.New("Goal not found")
+	ErrGoalNotRunning           = errors.New("Goal is not running")
+	ErrGoalNotPaused            = errors.New("Goal is not paused")
+	ErrGoalNotInError           = errors.New("Goal is not in error")
 )
 
 type Application struct {
 	sync.Mutex
-	Name                string
-	Configuration       *ApplicationConfiguration
-	Goals               map[string]*Goal
-	MainGoal            string
-	ApplicationFileName string
-	DockerClient        *client.Client
+	Name          string
+	Configuration *ApplicationConfiguration
+	Goals         map[string]*Goal
+	MainGoal      string
+	DockerClient  *client.Client
+	stopped       bool
+	events        *EventHub
 	*emission.Emitter
+	// operation serializes stopping, starting and updating of the whole
+	// application
+	operation sync.Mutex
 }
 
 type ApplicationStatus struct {
 	Name     string                `json:"name"`
 	Goals    map[string]GoalStatus `json:"goals"`
 	MainGoal string                `json:"main_goal"`
+	Stopped  bool                  `json:"stopped"`
 }
 
-func (a *Application) GoalStatusUpdate(goalName, status string) {
+// ApplicationUpdateStatus is the status of an application after its
+// configuration has been updated, together with changes made to its goals.
+type ApplicationUpdateStatus struct {
+	ApplicationStatus
+	ConfigurationDiff
+	Revision int `json:"revision"`
+}
+
+// goals returns a snapshot of application's goals that can be iterated
+// without holding the application lock.
+func (a *Application) goals() map[string]*Goal {
+	a.Lock()
+	defer a.Unlock()
+	goals := map[string]*Goal{}
 	for name, goal := range a.Goals {
+		goals[name] = goal
+	}
+	return goals
+}
+
+func (a *Application) GoalStatusUpdate(goalName, status string) {
+	for name, goal := range a.goals() {
 		if name != goalName {
 			goal.SiblingStatusUpdate(goalName, status)
 		}
 	}
-	a.Emitter.EmitAsync("update", a.Status())
+	a.emitUpdate()
 }
 
-func (a *Application) Status() ApplicationStatus {
-	a.Lock()
-
-	goals := make([]*Goal, 0)
+func (a *Application) emitUpdate() {
+	status := a.Status()
+	a.EmitAsync("update", status)
+	a.publishEvent(Event{Type: EventApplicationUpdate, Data: status})
+}
 
-	for _, goal := range a.Goals {
-		goals = append(goals, goal)
+// publishEvent publishes an event of the application or one of its goals.
+func (a *Application) publishEvent(evt Event) {
+	if a == nil {
+		return
 	}
+	evt.Application = a.Name
+	a.events.Publish(evt)
+}
+
+func (a *Application) Status() ApplicationStatus {
+	goals := a.goals()
 
+	a.Lock()
+	mainGoal := a.MainGoal
+	stopped := a.stopped
 	a.Unlock()
 
 	goalStats := map[string]GoalStatus{}
 
-	for name, goal := range a.Goals {
+	for name, goal := range goals {
 		goalStats[name] = goal.Status()
 	}
 
 	return ApplicationStatus{
 		Name:     a.Name,
 		Goals:    goalStats,
-		MainGoal: a.MainGoal,
+		MainGoal: mainGoal,
+		Stopped:  stopped,
 	}
 }
 
@@ -84,6 +124,72 @@ func (a *Application) goalByName(goalName string) (*Goal, error) {
 	return goal, nil
 }
 
+// TransitionLog returns the last status transitions of the goal.
+func (a *Application) TransitionLog(goalName string) ([]TransitionLogEntry, error) {
+	if a == nil {
+		return nil, ErrApplicationNotFound
+	}
+	goal, err := a.goalByName(goalName)
+	if err != nil {
+		return nil, err
+	}
+	return goal.TransitionLog(), nil
+}
+
+// GoalStats returns resource usage of the goal sampled after the time.
+func (a *Application) GoalStats(goalName string, since time.Time) ([]stats.Entry, error) {
+	if a == nil {
+		return nil, ErrApplicationNotFound
+	}
+	goal, err := a.goalByName(goalName)
+	if err != nil {
+		return nil, err
+	}
+	return goal.StatsSince(since), nil
+}
+
+// GoalCurrentStats returns the last resource usage of the goal reported by
+// Docker.
+func (a *Application) GoalCurrentStats(goalName string) (types.StatsJSON, error) {
+	if a == nil {
+		return types.StatsJSON{}, ErrApplicationNotFound
+	}
+	goal, err := a.goalByName(goalName)
+	if err != nil {
+		return types.StatsJSON{}, err
+	}
+	return goal.CurrentStats()
+}
+
+// OpenLogs starts reading output of the goal.
+func (a *Application) OpenLogs(ctx context.Context, goalName string, options LogOptions) (*LogStream, error) {
+	if a == nil {
+		return nil, ErrApplicationNotFound
+	}
+	goal, err := a.goalByName(goalName)
+	if err != nil {
+		return nil, err
+	}
+	return goal.OpenLogs(ctx, options)
+}
+
+// State returns the runtime state of the application that is persisted
+// across apparatchik restarts.
+func (a *Application) State() ApplicationState {
+	goals := a.goals()
+
+	state := ApplicationState{
+		Stopped:        a.IsStopped(),
+		TransitionLogs: map[string][]TransitionLogEntry{},
+	}
+
+	for name, goal := range goals {
+		state.TransitionLogs[name] = goal.TransitionLog()
+	}
+
+	return state
+}
+
 func (a *Application) Inspect(goalName string) (types.ContainerJSON, error) {
 	if a == nil {
 		return types.ContainerJSON{}, ErrApplicationNotFound
@@ -95,16 +201,356 @@ func (a *Application) Inspect(goalName string) (types.ContainerJSON, error) {
 	return goal.Inspect()
 }
 
-func (a *Application) startGoals() {
+func (a *Application) createGoals() {
 	a.Lock()
+	defer a.Unlock()
 	for goalName := range a.Configuration.Goals {
+		a.Goals[goalName] = NewGoal(a, goalName, a.Name, a.Configuration, a.DockerClient)
+	}
+}
 
-		a.Goals[goalName] = NewGoal(a, goalName, a.Name, a.Configuration.Goals, a.DockerClient)
+func (a *Application) startGoals() {
+	a.createNetworks()
+	a.createVolumes()
+	a.createGoals()
+	for _, goal := range a.Goals {
+		goal.FetchImage()
 	}
-	a.Unlock()
 	a.Goals[a.MainGoal].Start()
 }
 
+// restoreGoals re-creates goals of an application that was running before
+// apparatchik was restarted. Goals adopt their existing containers, only the
+// goals without a container are started from scratch. Goals of a stopped
+// application are not started.
+func (a *Application) restoreGoals(transitionLogs map[string][]TransitionLogEntry) {
+	a.createNetworks()
+	a.createVolumes()
+	a.createGoals()
+
+	for name, goal := range a.goals() {
+		goal.restoreTransitionLog(transitionLogs[name])
+	}
+
+	toFetch := []*Goal{}
+
+	for name, goal := range a.Goals {
+		adopted, err := goal.AdoptContainer()
+		if err != nil {
+			log.Error("Application ", a.Name, " could not adopt container of goal ", name, ": ", err)
+		}
+		if !adopted {
+			toFetch = append(toFetch, goal)
+		}
+	}
+
+	if a.stopped {
+		for _, goal := range a.Goals {
+			goal.markStopped()
+		}
+	}
+
+	a.seedGoalStatuses()
+
+	for _, goal := range a.Goals {
+		goal.broadcastStatus()
+	}
+
+	for _, goal := range toFetch {
+		goal.FetchImage()
+	}
+
+	if !a.stopped {
+		a.startMainGoal()
+	}
+}
+
+// startMainGoal starts the main goal unless its container already exited.
+// Exited goals keep their status, e.g. the one they were adopted with on
+// restore or a one-shot main goal that terminated before an update. Starting
+// one would leave it waiting for dependencies forever.
+func (a *Application) startMainGoal() {
+	a.Lock()
+	name := a.MainGoal
+	a.Unlock()
+
+	mainGoal, err := a.goalByName(name)
+	if err != nil || mainGoal.Exited() {
+		return
+	}
+	mainGoal.Start()
+}
+
+// seedGoalStatuses lets every goal know the current status of its siblings
+// without triggering starting or stopping of containers.
+func (a *Application) seedGoalStatuses() {
+	goals := a.goals()
+	for name, goal := range goals {
+		status := goal.Status().Status
+		for siblingName, sibling := range goals {
+			if siblingName != name {
+				sibling.SeedSiblingStatus(name, status)
+			}
+		}
+	}
+}
+
+// Update replaces configuration of the application. Only goals that have
+// changed (and goals linking them) are recreated, goals that are not part of
+// the new configuration are terminated. Changed volumes are removed and
+// created again, the caller rejects such updates when volumes are kept. An
+// update waits until the application has been stopped or started.
+func (a *Application) Update(config *ApplicationConfiguration) ConfigurationDiff {
+	a.operation.Lock()
+	defer a.operation.Unlock()
+
+	a.Lock()
+
+	diff := a.Configuration.Diff(config)
+
+	changedNetworks := []string{}
+	for _, name := range a.Configuration.ChangedNetworks(config) {
+		changedNetworks = append(changedNetworks, networkName(a.Name, name))
+	}
+
+	removedVolumes := []string{}
+	if config.removesVolumes() {
+		for name := range a.Configuration.Volumes {
+			if _, ok := config.Volumes[name]; !ok {
+				removedVolumes = append(removedVolumes, volumeName(a.Name, name))
+			}
+		}
+		for _, name := range diff.ChangedVolumes {
+			removedVolumes = append(removedVolumes, volumeName(a.Name, name))
+		}
+	}
+
+	oldOrder := a.Configuration.StartOrder()
+	oldGoals := map[string]*Goal{}
+	shouldRun := map[string]bool{}
+
+	for _, name := range append(diff.Removed, diff.Recreated...) {
+		goal := a.Goals[name]
+		oldGoals[name] = goal
+		goal.Lock()
+		shouldRun[name] = goal.ShouldRun && !a.stopped
+		goal.Unlock()
+		delete(a.Goals, name)
+	}
+
+	a.Configuration = config
+	a.MainGoal = config.MainGoal
+
+	newGoals := map[string]*Goal{}
+
+	for _, name := range append(diff.Recreated, diff.Added...) {
+		goal := NewGoal(a, name, a.Name, config, a.DockerClient)
+		a.Goals[name] = goal
+		newGoals[name] = goal
+	}
+
+	a.Unlock()
+
+	terminateGoals(oldOrder, oldGoals)
+
+	a.removeNetworks(changedNetworks)
+	a.createNetworks()
+	a.removeVolumes(removedVolumes)
+	a.createVolumes()
+
+	a.seedGoalStatuses()
+
+	for name, goal := range newGoals {
+		goal.FetchImage()
+		if shouldRun[name] {
+			goal.Start()
+		}
+	}
+
+	if !a.IsStopped() {
+		a.startMainGoal()
+	}
+
+	a.emitUpdate()
+
+	return diff
+}
+
+// Stop gracefully stops all goals in reverse dependency order, waiting for
+// each goal to exit before stopping the goals it depends on. The application
+// stays deployed and can be started again.
+func (a *Application) Stop() {
+	a.setStopped(true)
+	a.stopGoals()
+}
+
+// stopGoals stops goals of a stopped application one by one. It gives up
+// as soon as the application is started again, goals that are still running
+// then are left running.
+func (a *Application) stopGoals() {
+	a.operation.Lock()
+	defer a.operation.Unlock()
+
+	a.Lock()
+	order := a.Configuration.StartOrder()
+	a.Unlock()
+
+	goals := a.goals()
+
+	for i := len(order) - 1; i >= 0; i-- {
+		if !a.IsStopped() {
+			return
+		}
+		if goal, found := goals[order[i]]; found {
+			goal.Stop()
+		}
+	}
+
+	a.emitUpdate()
+}
+
+// Start starts a stopped application by starting its main goal, which in
+// turn starts all goals it depends on. When the application is still being
+// stopped, it waits until the goal being stopped has exited.
+func (a *Application) Start() {
+	a.setStopped(false)
+
+	a.operation.Lock()
+	defer a.operation.Unlock()
+
+	mainGoal, err := a.goalByName(a.MainGoal)
+	if err != nil {
+		log.Error("Application ", a.Name, " has no main goal ", a.MainGoal)
+		return
+	}
+
+	for _, goal := range a.goals() {
+		goal.resetRestarts()
+	}
+
+	mainGoal.rearm()
+	mainGoal.Start()
+
+	a.emitUpdate()
+}
+
+func (a *Application) setStopped(stopped bool) {
+	a.Lock()
+	defer a.Unlock()
+	a.stopped = stopped
+}
+
+func (a *Application) IsStopped() bool {
+	a.Lock()
+	defer a.Unlock()
+	return a.stopped
+}
+
+// StartGoal starts a single goal together with the goals it depends on.
+func (a *Application) StartGoal(goalName string) (GoalStatus, error) {
+	goal, err := a.goalByName(goalName)
+	if err != nil {
+		return GoalStatus{}, err
+	}
+	goal.resetRestarts()
+	goal.rearm()
+	goal.Start()
+	return goal.Status(), nil
+}
+
+// StopGoal stops a single goal in the background. Goals linking the stopped
+// goal are stopped as well.
+func (a *Application) StopGoal(goalName string) (GoalStatus, error) {
+	goal, err := a.goalByName(goalName)
+	if err != nil {
+		return GoalStatus{}, err
+	}
+	go goal.Stop()
+	return goal.Status(), nil
+}
+
+// KillGoal kills the container of a single goal in the background.
+func (a *Application) KillGoal(goalName string) (GoalStatus, error) {
+	goal, err := a.goalByName(goalName)
+	if err != nil {
+		return GoalStatus{}, err
+	}
+	go goal.Kill()
+	return goal.Status(), nil
+}
+
+// RestartGoal restarts a single goal in the background. Running goals
+// linking the restarted goal are stopped first and started again once the
+// goal is running.
+func (a *Application) RestartGoal(goalName string) (GoalStatus, error) {
+	goal, err := a.goalByName(goalName)
+	if err != nil {
+		return GoalStatus{}, err
+	}
+	go a.restartGoal(goal)
+	return goal.Status(), nil
+}
+
+func (a *Application) restartGoal(goal *Goal) {
+	a.Lock()
+	linking := a.Configuration.LinkingGoals(goal.Name)
+	a.Unlock()
+
+	goals := a.goals()
+
+	dependents := []*Goal{}
+	for i := len(linking) - 1; i >= 0; i-- {
+		dependent, found := goals[linking[i]]
+		if !found {
+			continue
+		}
+		status := dependent.Status().Status
+		if IsRunningStatus(status) || status == "paused" {
+			dependent.Stop()
+			dependents = append(dependents, dependent)
+		}
+	}
+
+	goal.resetRestarts()
+	goal.Restart()
+
+	status := goal.Status().Status
+	for i := len(dependents) - 1; i >= 0; i-- {
+		dependents[i].SeedSiblingStatus(goal.Name, status)
+		dependents[i].Start()
+	}
+}
+
+// PullGoal pulls the image of a goal that failed to pull it again.
+func (a *Application) PullGoal(goalName string) (GoalStatus, error) {
+	goal, err := a.goalByName(goalName)
+	if err != nil {
+		return GoalStatus{}, err
+	}
+	err = goal.RetryPull()
+	return goal.Status(), err
+}
+
+// PauseGoal pauses the running container of a single goal.
+func (a *Application) PauseGoal(goalName string) (GoalStatus, error) {
+	goal, err := a.goalByName(goalName)
+	if err != nil {
+		return GoalStatus{}, err
+	}
+	err = goal.Pause()
+	return goal.Status(), err
+}
+
+// UnpauseGoal resumes the paused container of a single goal.
+func (a *Application) UnpauseGoal(goalName string) (GoalStatus, error) {
+	goal, err := a.goalByName(goalName)
+	if err != nil {
+		return GoalStatus{}, err
+	}
+	err = goal.Unpause()
+	return goal.Status(), err
+}
+
 func NewApplicationWithDockerClientFromEnv(applicationName string, applicationConfiguration *ApplicationConfiguration) (*Application, error) {
 
 	dockerClient, err := client.NewEnvClient()
@@ -114,7 +560,7 @@ func NewApplicationWithDockerClientFromEnv(applicationName string, applicationCo
 
 	ch, _ := dockerClient.Events(context.Background(), types.EventsOptions{})
 
-	application := NewApplication(applicationName, applicationConfiguration, dockerClient)
+	application := NewApplication(applicationName, applicationConfiguration, dockerClient, nil)
 	go func() {
 		for evt := range ch {
 			application.HandleDockerEvent(evt)
@@ -123,55 +569,100 @@ func NewApplicationWithDockerClientFromEnv(applicationName string, applicationCo
 	return application, nil
 }
 
-func NewApplication(applicationName string, applicationConfiguration *ApplicationConfiguration, dockerClient *client.Client) *Application {
+// NewApplication creates the application and starts its goals. Events of
+// the application and its goals are published to the hub, unless it is nil.
+func NewApplication(applicationName string, applicationConfiguration *ApplicationConfiguration, dockerClient *client.Client, events *EventHub) *Application {
+
+	app := newApplication(applicationName, applicationConfiguration, dockerClient, events)
 
-	fileName := "/applications/" + applicationName + ".json"
+	app.startGoals()
 
-	json, err := json.Marshal(applicationConfiguration)
+	app.emitUpdate()
 
-	if err != nil {
-		panic(err)
-	}
+	return app
 
-	ioutil.WriteFile(fileName, json, 0644)
+}
 
-	emitter := emission.NewEmitter()
-	emitter.SetMaxListeners(MaxListeners)
+// RestoreApplication re-creates an application from a descriptor persisted by
+// a previous apparatchik process, reattaching to its running containers.
+func RestoreApplication(applicationName string, applicationConfiguration *ApplicationConfiguration, state ApplicationState, dockerClient *client.Client, events *EventHub) *Application {
 
-	app := &Application{
-		Name:                applicationName,
-		Configuration:       applicationConfiguration,
-		Goals:               map[string]*Goal{},
-		MainGoal:            applicationConfiguration.MainGoal,
-		ApplicationFileName: fileName,
-		DockerClient:        dockerClient,
-		Emitter:             emitter,
-	}
+	app := newApplication(applicationName, applicationConfiguration, dockerClient, events)
+	app.stopped = state.Stopped
 
-	app.startGoals()
+	app.restoreGoals(state.TransitionLogs)
 
-	app.EmitAsync("update", app.Status())
+	app.emitUpdate()
 
 	return app
+}
 
+func newApplication(applicationName string, applicationConfiguration *ApplicationConfiguration, dockerClient *client.Client, events *EventHub) *Application {
+	emitter := emission.NewEmitter()
+	emitter.SetMaxListeners(MaxListeners)
+
+	return &Application{
+		Name:          applicationName,
+		Configuration: applicationConfiguration,
+		Goals:         map[string]*Goal{},
+		MainGoal:      applicationConfiguration.MainGoal,
+		DockerClient:  dockerClient,
+		events:        events,
+		Emitter:       emitter,
+	}
 }
 
+// TerminateApplication stops goals of the application in reverse start order
+// and removes their containers, networks and (depending on the volume policy)
+// volumes.
 func (a *Application) TerminateApplication() {
 	a.Lock()
-	defer a.Unlock()
+	order := a.Configuration.StartOrder()
+	goals := map[string]*Goal{}
+	for name, goal := range a.Goals {
+		goals[name] = goal
+	}
 
-	os.Remove(a.ApplicationFileName)
-	for _, goal := range a.Goals {
-		goal.TerminateGoal()
+	networks := []string{}
+	for name := range a.Configuration.dockerNetworks(a.Name) {
+		networks = append(networks, name)
 	}
 
+	volumes := []string{}
+	if a.Configuration.removesVolumes() {
+		for name := range a.Configuration.dockerVolumes(a.Name) {
+			volumes = append(volumes, name)
+		}
+	}
+	a.Unlock()
+
+	terminateGoals(order, goals)
+
+	a.removeNetworks(networks)
+	a.removeVolumes(volumes)
+
 	a.EmitAsync("terminated")
+	a.publishEvent(Event{Type: EventApplicationTerminated})
 }
 
+// terminateGoals terminates goals one by one in reverse of the start order,
+// so that each goal exits before the goals it depends on are stopped.
+func terminateGoals(order []string, goals map[string]*Goal) {
+	for i := len(order) - 1; i >= 0; i-- {
+		if goal, found := goals[order[i]]; found {
+			goal.TerminateGoal()
+		}
+	}
+}
+
+// RequestGoalStart starts a goal other goals depend on. Goals that exited
+// are only started again by the user.
 func (a *Application) RequestGoalStart(name string) {
 
-	if goal, ok := a.Goals[name]; ok {
-		goal.Start()
+	if goal, err := a.goalByName(name); err == nil {
+		if !goal.Exited() {
+			goal.Start()
+		}
 		return
 	}
 	log.Warn("Application ", a.Name, " requested start of uknown goal ", name)
@@ -5,14 +5,19 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 )
 
 type ApplicationConfiguration struct {
-	Goals    map[string]*GoalConfiguration `json:"goals"`
-	MainGoal string                        `json:"main_goal"`
+	Goals        map[string]*GoalConfiguration    `json:"goals"`
+	MainGoal     string                           `json:"main_goal"`
+	Networks     map[string]*NetworkConfiguration `json:"networks,omitempty"`
+	Volumes      map[string]*VolumeConfiguration  `json:"volumes,omitempty"`
+	VolumePolicy string                           `json:"volume_policy,omitempty"`
 }
 
 func (a *ApplicationConfiguration) findCircularDependency(goalName string, seen ...string) error {
@@ -112,6 +117,108 @@ type GoalConfiguration struct {
 	ContainerName string            `json:"container_name,omitempty"`
 	ExternalLinks []string          `json:"external_links,omitempty"`
 	SmartRestart  bool              `json:"smart_restart,omitempty"`
+
+	RestartInitialBackoff Duration `json:"restart_initial_backoff,omitempty"`
+	RestartMaxBackoff     Duration `json:"restart_max_backoff,omitempty"`
+	RestartMaxAttempts    int      `json:"restart_max_attempts,omitempty"`
+	RestartResetWindow    Duration `json:"restart_reset_window,omitempty"`
+
+	Healthcheck *HealthcheckConfiguration `json:"healthcheck,omitempty"`
+	PullPolicy  string                    `json:"pull_policy,omitempty"`
+
+	PullRetries        *int     `json:"pull_retries,omitempty"`
+	PullInitialBackoff Duration `json:"pull_initial_backoff,omitempty"`
+	PullMaxBackoff     Duration `json:"pull_max_backoff,omitempty"`
+
+	Networks []string `json:"networks,omitempty"`
+
+	VolumesFrom []string `json:"volumes_from,omitempty"`
+	Tmpfs       []string `json:"tmpfs,omitempty"`
+
+	CpusetMems     string                          `json:"cpuset_mems,omitempty"`
+	Cpus           float64                         `json:"cpus,omitempty"`
+	MemReservation int64                           `json:"mem_reservation,omitempty"`
+	PidsLimit      int64                           `json:"pids_limit,omitempty"`
+	Ulimits        map[string]*UlimitConfiguration `json:"ulimits,omitempty"`
+	ShmSize        int64                           `json:"shm_size,omitempty"`
+	Sysctls        map[string]string               `json:"sysctls,omitempty"`
+	OomScoreAdj    int                             `json:"oom_score_adj,omitempty"`
+	OomKillDisable bool                            `json:"oom_kill_disable,omitempty"`
+	BlkioWeight    uint16                          `json:"blkio_weight,omitempty"`
+	Init           *bool                           `json:"init,omitempty"`
+
+	StopSignal      string   `json:"stop_signal,omitempty"`
+	StopGracePeriod Duration `json:"stop_grace_period,omitempty"`
+}
+
+const (
+	DefaultRestartInitialBackoff = time.Second
+	DefaultRestartMaxBackoff     = 5 * time.Minute
+	DefaultRestartResetWindow    = 10 * time.Minute
+
+	DefaultPullRetries        = 5
+	DefaultPullInitialBackoff = 2 * time.Second
+	DefaultPullMaxBackoff     = time.Minute
+)
+
+// restartBackoff returns the delay before the smart restart following the
+// given number of consecutive restarts.
+func (gc *GoalConfiguration) restartBackoff(restarts int) time.Duration {
+	backoff := time.Duration(gc.RestartInitialBackoff)
+	if backoff == 0 {
+		backoff = DefaultRestartInitialBackoff
+	}
+
+	maxBackoff := time.Duration(gc.RestartMaxBackoff)
+	if maxBackoff == 0 {
+		maxBackoff = DefaultRestartMaxBackoff
+	}
+
+	return exponentialBackoff(backoff, maxBackoff, restarts)
+}
+
+// pullRetries returns how many times pulling of the image is retried before
+// the goal ends up in the error status.
+func (gc *GoalConfiguration) pullRetries() int {
+	if gc.PullRetries == nil {
+		return DefaultPullRetries
+	}
+	return *gc.PullRetries
+}
+
+// pullBackoff returns the delay before retrying to pull the image after the
+// given number of failed retries.
+func (gc *GoalConfiguration) pullBackoff(retries int) time.Duration {
+	backoff := time.Duration(gc.PullInitialBackoff)
+	if backoff == 0 {
+		backoff = DefaultPullInitialBackoff
+	}
+
+	maxBackoff := time.Duration(gc.PullMaxBackoff)
+	if maxBackoff == 0 {
+		maxBackoff = DefaultPullMaxBackoff
+	}
+
+	return exponentialBackoff(backoff, maxBackoff, retries)
+}
+
+// restartResetWindow returns for how long a container has to run before the
+// number of consecutive restarts is reset.
+func (gc *GoalConfiguration) restartResetWindow() time.Duration {
+	if gc.RestartResetWindow == 0 {
+		return DefaultRestartResetWindow
+	}
+	return time.Duration(gc.RestartResetWindow)
+}
+
+// stopGracePeriod returns for how long a stopped container may run before it
+// is killed, nil for the Docker default.
+func (gc *GoalConfiguration) stopGracePeriod() *time.Duration {
+	if gc.StopGracePeriod == 0 {
+		return nil
+	}
+	period := time.Duration(gc.StopGracePeriod)
+	return &period
 }
 
 func (gc *GoalConfiguration) dependsOn() []string {
@@ -125,6 +232,10 @@ func (gc *GoalConfiguration) dependsOn() []string {
 		depsMap[ra] = struct{}{}
 	}
 
+	for _, vf := range gc.volumesFromGoals() {
+		depsMap[vf] = struct{}{}
+	}
+
 	deps := []string{}
 
 	for k := range depsMap {
@@ -141,6 +252,15 @@ func (gc *GoalConfiguration) Clone() *GoalConfiguration {
 	return &copy
 }
 
+// volumesFromGoals returns names of goals the goal mounts volumes from.
+func (gc *GoalConfiguration) volumesFromGoals() []string {
+	result := []string{}
+	for _, vf := range gc.VolumesFrom {
+		result = append(result, strings.SplitN(vf, ":", 2)[0])
+	}
+	return result
+}
+
 type LinkedContainer struct {
 	Name  string
 	Alias string
@@ -152,9 +272,9 @@ func (gc *GoalConfiguration) LinkedContainers() []LinkedContainer {
 
 	for _, link := range gc.Links {
 
-		parts := strings.SplitN(link, ":", 2)
+		parts := strings.SplitN(link, ":", 3)
 		lc := LinkedContainer{parts[0], parts[0]}
-		if len(parts) == 2 {
+		if len(parts) > 1 && parts[1] != "" {
 			lc.Alias = parts[1]
 		}
 		result = append(result, lc)
@@ -164,8 +284,38 @@ func (gc *GoalConfiguration) LinkedContainers() []LinkedContainer {
 
 }
 
+// HealthyLinks returns names of linked goals that have to be healthy, not
+// only running, before the goal can start. Such links have the form
+// "name:alias:healthy".
+func (gc *GoalConfiguration) HealthyLinks() map[string]bool {
+	result := map[string]bool{}
+
+	for _, link := range gc.Links {
+		parts := strings.SplitN(link, ":", 3)
+		if len(parts) == 3 && parts[2] == "healthy" {
+			result[parts[0]] = true
+		}
+	}
+
+	return result
+}
+
 func (c *ApplicationConfiguration) Clone() *ApplicationConfiguration {
 	clone := *c
+	if c.Networks != nil {
+		clone.Networks = map[string]*NetworkConfiguration{}
+		for name, network := range c.Networks {
+			copy := *network
+			clone.Networks[name] = &copy
+		}
+	}
+	if c.Volumes != nil {
+		clone.Volumes = map[string]*VolumeConfiguration{}
+		for name, volume := range c.Volumes {
+			copy := *volume
+			clone.Volumes[name] = &copy
+		}
+	}
 	clone.Goals = map[string]*GoalConfiguration{}
 	for goalName, goal := range c.Goals {
 
@@ -174,8 +324,210 @@ func (c *ApplicationConfiguration) Clone() *ApplicationConfiguration {
 	return &clone
 }
 
+// StartOrder returns names of all goals ordered so that each goal comes after
+// all goals it depends on. Configuration has to be valid.
+func (c *ApplicationConfiguration) StartOrder() []string {
+	names := []string{}
+	for name := range c.Goals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	order := []string{}
+	visited := map[string]bool{}
+
+	var visit func(name string)
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		for _, d := range c.Goals[name].dependsOn() {
+			visit(d)
+		}
+		order = append(order, name)
+	}
+
+	for _, name := range names {
+		visit(name)
+	}
+
+	return order
+}
+
+// LinkingGoals returns names of all goals that directly or indirectly link
+// the goal, in start order.
+func (c *ApplicationConfiguration) LinkingGoals(goalName string) []string {
+	linking := map[string]bool{goalName: true}
+
+	for changed := true; changed; {
+		changed = false
+		for name, goal := range c.Goals {
+			if linking[name] {
+				continue
+			}
+			for _, lc := range goal.LinkedContainers() {
+				if linking[lc.Name] {
+					linking[name] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	result := []string{}
+	for _, name := range c.StartOrder() {
+		if name != goalName && linking[name] {
+			result = append(result, name)
+		}
+	}
+
+	return result
+}
+
+// requiredGoals returns the goal and all goals it depends on, directly or
+// through other goals, in the start order.
+func (c *ApplicationConfiguration) requiredGoals(goalName string) []string {
+	required := map[string]bool{}
+	pending := []string{goalName}
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		goal, found := c.Goals[name]
+		if required[name] || !found {
+			continue
+		}
+		required[name] = true
+		pending = append(pending, goal.dependsOn()...)
+	}
+
+	result := []string{}
+	for _, name := range c.StartOrder() {
+		if required[name] {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// ConfigurationDiff describes what has to happen with each goal when an
+// application configuration is replaced with a new one.
+type ConfigurationDiff struct {
+	Kept           []string `json:"kept"`
+	Recreated      []string `json:"recreated"`
+	Added          []string `json:"added"`
+	Removed        []string `json:"removed"`
+	ChangedVolumes []string `json:"changed_volumes"`
+}
+
+// Diff compares goals of the configuration with goals of the new
+// configuration. Goals with a changed configuration, changed aliases or
+// mounting a changed volume have to be recreated, as well as all goals
+// linking them or mounting their volumes.
+func (c *ApplicationConfiguration) Diff(newConfig *ApplicationConfiguration) ConfigurationDiff {
+	diff := ConfigurationDiff{
+		Kept:           []string{},
+		Recreated:      []string{},
+		Added:          []string{},
+		Removed:        []string{},
+		ChangedVolumes: c.ChangedVolumes(newConfig),
+	}
+
+	oldGoals := map[string]*GoalConfiguration{}
+	if c != nil {
+		oldGoals = c.Goals
+	}
+
+	for name := range oldGoals {
+		if _, found := newConfig.Goals[name]; !found {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+
+	recreated := map[string]bool{}
+
+	for name, goal := range newConfig.Goals {
+		oldGoal, found := oldGoals[name]
+		if !found {
+			diff.Added = append(diff.Added, name)
+		} else if !reflect.DeepEqual(oldGoal, goal) || c.networksChanged(newConfig, goal.Networks) ||
+			!reflect.DeepEqual(goalAliases(name, oldGoals), goalAliases(name, newConfig.Goals)) ||
+			mountsVolume(goal, diff.ChangedVolumes) {
+			recreated[name] = true
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for name, goal := range newConfig.Goals {
+			if _, found := oldGoals[name]; !found || recreated[name] {
+				continue
+			}
+			for _, lc := range goal.LinkedContainers() {
+				if recreated[lc.Name] {
+					recreated[name] = true
+					changed = true
+					break
+				}
+			}
+			for _, vf := range goal.volumesFromGoals() {
+				if recreated[vf] && !recreated[name] {
+					recreated[name] = true
+					changed = true
+				}
+			}
+		}
+	}
+
+	for name := range newConfig.Goals {
+		if _, found := oldGoals[name]; !found {
+			continue
+		}
+		if recreated[name] {
+			diff.Recreated = append(diff.Recreated, name)
+		} else {
+			diff.Kept = append(diff.Kept, name)
+		}
+	}
+
+	sort.Strings(diff.Kept)
+	sort.Strings(diff.Recreated)
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+
+	return diff
+}
+
+// ChangedNetworks returns names of networks that are removed or configured
+// differently in the new configuration.
+func (c *ApplicationConfiguration) ChangedNetworks(newConfig *ApplicationConfiguration) []string {
+	changed := []string{}
+	if c == nil {
+		return changed
+	}
+	for name, network := range c.Networks {
+		if !reflect.DeepEqual(network, newConfig.Networks[name]) {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func (c *ApplicationConfiguration) networksChanged(newConfig *ApplicationConfiguration, networks []string) bool {
+	for _, name := range networks {
+		if !reflect.DeepEqual(c.Networks[name], newConfig.Networks[name]) {
+			return true
+		}
+	}
+	return false
+}
+
 var goalNameExpression = regexp.MustCompile("^[0-9a-zA-Z_\\.\\-]+$")
 
+var stopSignalExpression = regexp.MustCompile("^([A-Z][A-Z0-9+-]*|[0-9]+)$")
+
 var imageExpression = regexp.MustCompile("^[0-9a-zA-Z\\.\\-/:_]+:[0-9a-zA-Z\\.\\-_]+$")
 
 func (c *ApplicationConfiguration) Validate() error {
@@ -199,6 +551,84 @@ func (c *ApplicationConfiguration) Validate() error {
 			}
 		}
 
+		if goal.RestartInitialBackoff < 0 || goal.RestartMaxBackoff < 0 || goal.RestartResetWindow < 0 || goal.RestartMaxAttempts < 0 {
+			return fmt.Errorf("Goal %q has negative restart options", name)
+		}
+
+		if (goal.PullRetries != nil && *goal.PullRetries < 0) || goal.PullInitialBackoff < 0 || goal.PullMaxBackoff < 0 {
+			return fmt.Errorf("Goal %q has negative pull options", name)
+		}
+
+		if goal.StopSignal != "" && !stopSignalExpression.MatchString(goal.StopSignal) {
+			return fmt.Errorf("Goal %q has invalid stop signal %q", name, goal.StopSignal)
+		}
+
+		if goal.StopGracePeriod < 0 {
+			return fmt.Errorf("Goal %q has negative stop grace period", name)
+		}
+
+		if goal.PullPolicy != "" {
+			if err := ValidatePullPolicy(goal.PullPolicy); err != nil {
+				return fmt.Errorf("Goal %q: %s", name, err)
+			}
+		}
+
+		if err := goal.validateResources(); err != nil {
+			return fmt.Errorf("Goal %q: %s", name, err)
+		}
+
+		if goal.Healthcheck != nil {
+			if err := goal.Healthcheck.validate(); err != nil {
+				return fmt.Errorf("Goal %q: %s", name, err)
+			}
+		}
+
+		for _, link := range goal.Links {
+			parts := strings.SplitN(link, ":", 3)
+			if len(parts) == 3 && parts[2] != "healthy" && parts[2] != "running" {
+				return fmt.Errorf("Goal %q has a link %q with unknown condition %q", name, link, parts[2])
+			}
+			if target, ok := c.Goals[parts[0]]; ok && len(parts) == 3 && parts[2] == "healthy" && !target.Healthcheck.reportsHealth() {
+				return fmt.Errorf("Goal %q waits for goal %q to be healthy, but it has no health check", name, parts[0])
+			}
+		}
+
+		for _, network := range goal.Networks {
+			if _, ok := c.Networks[network]; !ok {
+				return fmt.Errorf("Goal %q joins network %q that does not exist", name, network)
+			}
+		}
+
+		if goal.Net != "" && len(goal.Networks) > 0 {
+			return fmt.Errorf("Goal %q can't set net and join networks", name)
+		}
+
+		for _, volume := range goal.Volumes {
+			source, target, _ := parseVolume(volume)
+			if isRelativePath(source) {
+				return fmt.Errorf("Goal %q mounts relative host path %q", name, source)
+			}
+			if !strings.HasPrefix(target, "/") {
+				return fmt.Errorf("Goal %q mounts volume %q to relative path %q", name, volume, target)
+			}
+		}
+
+		for _, volumesFrom := range goal.VolumesFrom {
+			parts := strings.SplitN(volumesFrom, ":", 2)
+			if _, ok := c.Goals[parts[0]]; !ok {
+				return fmt.Errorf("Goal %q mounts volumes from goal %q that does not exist", name, parts[0])
+			}
+			if len(parts) == 2 && parts[1] != "ro" && parts[1] != "rw" {
+				return fmt.Errorf("Goal %q mounts volumes from goal %q with unknown mode %q", name, parts[0], parts[1])
+			}
+		}
+
+		for _, tmpfs := range goal.Tmpfs {
+			if !strings.HasPrefix(tmpfs, "/") {
+				return fmt.Errorf("Goal %q mounts tmpfs to relative path %q", name, tmpfs)
+			}
+		}
+
 		// Goal 'test' links goal 'test2' that does not exist
 		for _, linkedContainer := range goal.LinkedContainers() {
 			if _, ok := c.Goals[linkedContainer.Name]; !ok {
@@ -207,10 +637,62 @@ func (c *ApplicationConfiguration) Validate() error {
 		}
 	}
 
-	err := c.validateCircularDependencies()
+	for name, network := range c.Networks {
+		if !goalNameExpression.MatchString(name) {
+			return fmt.Errorf("Network %q has invalid name", name)
+		}
+		if network == nil {
+			return fmt.Errorf("Network %q has no configuration", name)
+		}
+	}
+
+	for name, volume := range c.Volumes {
+		if !goalNameExpression.MatchString(name) {
+			return fmt.Errorf("Volume %q has invalid name", name)
+		}
+		if volume == nil {
+			return fmt.Errorf("Volume %q has no configuration", name)
+		}
+	}
+
+	if c.VolumePolicy != "" && c.VolumePolicy != VolumePolicyRemove && c.VolumePolicy != VolumePolicyKeep {
+		return fmt.Errorf("Unknown volume policy %q", c.VolumePolicy)
+	}
+
+	err := c.validateLinkAliases()
 	if err != nil {
 		return err
 	}
 
+	err = c.validateCircularDependencies()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validateLinkAliases makes sure that names of goals and aliases of links
+// resolve to a single goal. All aliases are registered on the application
+// network shared by all goals, unlike with Docker links they are not scoped
+// to the linking goal.
+func (c *ApplicationConfiguration) validateLinkAliases() error {
+	targets := map[string]string{}
+	names := []string{}
+	for name := range c.Goals {
+		targets[name] = name
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, lc := range c.Goals[name].LinkedContainers() {
+			if target, ok := targets[lc.Alias]; ok && target != lc.Name {
+				return fmt.Errorf("Goal %q links goal %q as %q, which already resolves to goal %q", name, lc.Name, lc.Alias, target)
+			}
+			targets[lc.Alias] = lc.Name
+		}
+	}
+
 	return nil
 }
@@ -1,7 +1,9 @@
 package core
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -84,3 +86,321 @@ func TestLinkedContainers(t *testing.T) {
 	goal := GoalConfiguration{Links: []string{"c1", "c2:alias"}}
 	require.Equal(t, []LinkedContainer{LinkedContainer{"c1", "c1"}, LinkedContainer{"c2", "alias"}}, goal.LinkedContainers())
 }
+
+func TestDiffOfEqualConfigurationsKeepsAllGoals(t *testing.T) {
+	diff := validConfiguration.Diff(validConfiguration.Clone())
+	require.Equal(t, ConfigurationDiff{
+		Kept:           []string{"otherTest", "test"},
+		Recreated:      []string{},
+		Added:          []string{},
+		Removed:        []string{},
+		ChangedVolumes: []string{},
+	}, diff)
+}
+
+func TestDiffRecreatesChangedGoalsAndGoalsLinkingThem(t *testing.T) {
+	oldConfig := validConfiguration.Clone()
+	oldConfig.Goals["linking"] = &GoalConfiguration{Image: "alpine:3.2", Links: []string{"otherTest:other"}}
+	oldConfig.Goals["linkingLinking"] = &GoalConfiguration{Image: "alpine:3.2", Links: []string{"linking"}}
+	oldConfig.Goals["runAfter"] = &GoalConfiguration{Image: "alpine:3.2", RunAfter: []string{"otherTest"}}
+
+	newConfig := oldConfig.Clone()
+	newConfig.Goals["otherTest"].Image = "alpine:3.4"
+
+	diff := oldConfig.Diff(newConfig)
+	require.Equal(t, []string{"runAfter", "test"}, diff.Kept)
+	require.Equal(t, []string{"linking", "linkingLinking", "otherTest"}, diff.Recreated)
+}
+
+func TestDiffReportsAddedAndRemovedGoals(t *testing.T) {
+	newConfig := validConfiguration.Clone()
+	delete(newConfig.Goals, "otherTest")
+	newConfig.Goals["new"] = &GoalConfiguration{Image: "alpine:3.2"}
+
+	diff := validConfiguration.Diff(newConfig)
+	require.Equal(t, []string{"test"}, diff.Kept)
+	require.Equal(t, []string{"new"}, diff.Added)
+	require.Equal(t, []string{"otherTest"}, diff.Removed)
+}
+
+func TestStartOrderPutsDependenciesFirst(t *testing.T) {
+	config := validConfiguration.Clone()
+	config.Goals["test"].Links = []string{"db"}
+	config.Goals["test"].RunAfter = []string{"migrate"}
+	config.Goals["migrate"] = &GoalConfiguration{Image: "alpine:3.2", Links: []string{"db"}}
+	config.Goals["db"] = &GoalConfiguration{Image: "alpine:3.2"}
+
+	require.Equal(t, []string{"db", "migrate", "otherTest", "test"}, config.StartOrder())
+}
+
+func TestLinkingGoalsFollowsLinksTransitively(t *testing.T) {
+	config := validConfiguration.Clone()
+	config.Goals["test"].Links = []string{"app"}
+	config.Goals["app"] = &GoalConfiguration{Image: "alpine:3.2", Links: []string{"db:database"}}
+	config.Goals["migrate"] = &GoalConfiguration{Image: "alpine:3.2", RunAfter: []string{"db"}}
+	config.Goals["db"] = &GoalConfiguration{Image: "alpine:3.2"}
+
+	require.Equal(t, []string{"app", "test"}, config.LinkingGoals("db"))
+	require.Equal(t, []string{}, config.LinkingGoals("test"))
+}
+
+func TestRestartBackoffDoublesUpToMaximum(t *testing.T) {
+	goal := &GoalConfiguration{
+		RestartInitialBackoff: Duration(2 * time.Second),
+		RestartMaxBackoff:     Duration(10 * time.Second),
+	}
+
+	require.Equal(t, 2*time.Second, goal.restartBackoff(0))
+	require.Equal(t, 4*time.Second, goal.restartBackoff(1))
+	require.Equal(t, 8*time.Second, goal.restartBackoff(2))
+	require.Equal(t, 10*time.Second, goal.restartBackoff(3))
+	require.Equal(t, 10*time.Second, goal.restartBackoff(100))
+
+	require.Equal(t, DefaultRestartInitialBackoff, (&GoalConfiguration{}).restartBackoff(0))
+	require.Equal(t, DefaultRestartMaxBackoff, (&GoalConfiguration{}).restartBackoff(100))
+}
+
+func TestRestartOptionsAreParsedFromDurationStrings(t *testing.T) {
+	goal := &GoalConfiguration{}
+	err := json.Unmarshal([]byte(`{"restart_initial_backoff": "500ms", "restart_max_backoff": "1m", "restart_max_attempts": 3}`), goal)
+	require.Nil(t, err)
+	require.Equal(t, Duration(500*time.Millisecond), goal.RestartInitialBackoff)
+	require.Equal(t, Duration(time.Minute), goal.RestartMaxBackoff)
+	require.Equal(t, 3, goal.RestartMaxAttempts)
+	require.Equal(t, DefaultRestartResetWindow, goal.restartResetWindow())
+
+	require.NotNil(t, json.Unmarshal([]byte(`{"restart_max_backoff": "often"}`), goal))
+}
+
+func TestLinksCanWaitForHealthyGoals(t *testing.T) {
+	goal := &GoalConfiguration{Links: []string{"db:database:healthy", "cache::healthy", "web"}}
+	require.Equal(t, []LinkedContainer{{"db", "database"}, {"cache", "cache"}, {"web", "web"}}, goal.LinkedContainers())
+	require.Equal(t, map[string]bool{"db": true, "cache": true}, goal.HealthyLinks())
+}
+
+func TestApplicationConfigurationChecksLinkConditions(t *testing.T) {
+	copy := validConfiguration.Clone()
+	copy.Goals["test"].Links = []string{"otherTest:other:ready"}
+	require.NotNil(t, copy.Validate())
+	require.Equal(t, `Goal "test" has a link "otherTest:other:ready" with unknown condition "ready"`, copy.Validate().Error())
+}
+
+func TestApplicationConfigurationChecksHealthyLinksHaveHealthchecks(t *testing.T) {
+	copy := validConfiguration.Clone()
+	copy.Goals["test"].Links = []string{"otherTest:other:healthy"}
+	require.NotNil(t, copy.Validate())
+	require.Equal(t, `Goal "test" waits for goal "otherTest" to be healthy, but it has no health check`, copy.Validate().Error())
+
+	copy.Goals["otherTest"].Healthcheck = &HealthcheckConfiguration{Test: []string{"pg_isready"}}
+	require.Nil(t, copy.Validate())
+
+	copy.Goals["otherTest"].Healthcheck = &HealthcheckConfiguration{TCP: &TCPHealthcheck{Port: 5432}}
+	require.Nil(t, copy.Validate())
+}
+
+func TestApplicationConfigurationChecksHealthchecks(t *testing.T) {
+	copy := validConfiguration.Clone()
+	copy.Goals["test"].Healthcheck = &HealthcheckConfiguration{TCP: &TCPHealthcheck{Port: 5432}, Exec: []string{"pg_isready"}}
+	require.NotNil(t, copy.Validate())
+	require.Equal(t, `Goal "test": only one of http, tcp and exec health checks can be set`, copy.Validate().Error())
+}
+
+func TestApplicationConfigurationChecksPullPolicy(t *testing.T) {
+	copy := validConfiguration.Clone()
+	copy.Goals["test"].PullPolicy = PullIfNotPresent
+	require.Nil(t, copy.Validate())
+
+	copy.Goals["test"].PullPolicy = "sometimes"
+	require.NotNil(t, copy.Validate())
+	require.Equal(t, `Goal "test": Unknown pull policy "sometimes"`, copy.Validate().Error())
+}
+
+func TestPullRetriesDefaultsAndBackoff(t *testing.T) {
+	goal := &GoalConfiguration{}
+	require.Equal(t, DefaultPullRetries, goal.pullRetries())
+	require.Equal(t, DefaultPullInitialBackoff, goal.pullBackoff(0))
+	require.Equal(t, DefaultPullMaxBackoff, goal.pullBackoff(10))
+
+	noRetries := 0
+	goal = &GoalConfiguration{PullRetries: &noRetries, PullInitialBackoff: Duration(time.Second)}
+	require.Equal(t, 0, goal.pullRetries())
+	require.Equal(t, 4*time.Second, goal.pullBackoff(2))
+}
+
+func TestApplicationConfigurationChecksNetworks(t *testing.T) {
+	copy := validConfiguration.Clone()
+	copy.Goals["test"].Networks = []string{"backend"}
+	require.NotNil(t, copy.Validate())
+	require.Equal(t, `Goal "test" joins network "backend" that does not exist`, copy.Validate().Error())
+
+	copy.Networks = map[string]*NetworkConfiguration{"backend": &NetworkConfiguration{Internal: true}}
+	require.Nil(t, copy.Validate())
+}
+
+func TestApplicationConfigurationChecksConflictingLinkAliases(t *testing.T) {
+	copy := validConfiguration.Clone()
+	copy.Goals["db"] = &GoalConfiguration{Image: "postgres:9.6"}
+	copy.Goals["cache"] = &GoalConfiguration{Image: "redis:3.2"}
+	copy.Goals["test"].Links = []string{"db:store"}
+	copy.Goals["otherTest"].Links = []string{"db:store"}
+	require.Nil(t, copy.Validate())
+
+	copy.Goals["otherTest"].Links = []string{"cache:store"}
+	require.NotNil(t, copy.Validate())
+	require.Equal(t, `Goal "test" links goal "db" as "store", which already resolves to goal "cache"`, copy.Validate().Error())
+
+	copy.Goals["otherTest"].Links = []string{"cache:db"}
+	require.NotNil(t, copy.Validate())
+	require.Equal(t, `Goal "otherTest" links goal "cache" as "db", which already resolves to goal "db"`, copy.Validate().Error())
+}
+
+func TestDiffRecreatesGoalsJoiningChangedNetworks(t *testing.T) {
+	old := validConfiguration.Clone()
+	old.Networks = map[string]*NetworkConfiguration{"backend": &NetworkConfiguration{}}
+	old.Goals["test"].Networks = []string{"backend"}
+
+	changed := old.Clone()
+	changed.Networks["backend"].Internal = true
+
+	diff := old.Diff(changed)
+	require.Equal(t, []string{"test"}, diff.Recreated)
+	require.Equal(t, []string{"otherTest"}, diff.Kept)
+	require.Equal(t, []string{"backend"}, old.ChangedNetworks(changed))
+}
+
+func TestApplicationConfigurationChecksVolumes(t *testing.T) {
+	copy := validConfiguration.Clone()
+	copy.Goals["test"].Volumes = []string{"./data:/data"}
+	require.NotNil(t, copy.Validate())
+	require.Equal(t, `Goal "test" mounts relative host path "./data"`, copy.Validate().Error())
+
+	copy.Goals["test"].Volumes = []string{"data:/data"}
+	require.Nil(t, copy.Validate())
+
+	copy.Volumes = map[string]*VolumeConfiguration{"data": &VolumeConfiguration{Driver: "local"}}
+	require.Nil(t, copy.Validate())
+
+	copy.VolumePolicy = "sometimes"
+	require.NotNil(t, copy.Validate())
+	require.Equal(t, `Unknown volume policy "sometimes"`, copy.Validate().Error())
+}
+
+func TestResolveRelativeVolumesOfStoredDescriptors(t *testing.T) {
+	copy := validConfiguration.Clone()
+	copy.Goals["test"].Volumes = []string{"./data:/data", "./logs:ro", "/srv:/srv", "cache:/cache"}
+
+	copy.resolveRelativeVolumes("/opt/apparatchik")
+	require.Equal(t, []string{"/opt/apparatchik/data:/data", "/opt/apparatchik/logs:/opt/apparatchik/logs:ro", "/srv:/srv", "cache:/cache"}, copy.Goals["test"].Volumes)
+	require.Nil(t, copy.Validate())
+}
+
+func TestApplicationConfigurationChecksVolumesFrom(t *testing.T) {
+	copy := validConfiguration.Clone()
+	copy.Goals["test"].VolumesFrom = []string{"data"}
+	require.NotNil(t, copy.Validate())
+	require.Equal(t, `Goal "test" mounts volumes from goal "data" that does not exist`, copy.Validate().Error())
+
+	copy.Goals["test"].VolumesFrom = []string{"otherTest:ro"}
+	require.Nil(t, copy.Validate())
+	require.Equal(t, []string{"otherTest", "test"}, copy.StartOrder())
+}
+
+func TestDiffRecreatesGoalsMountingVolumesFromRecreatedGoals(t *testing.T) {
+	old := validConfiguration.Clone()
+	old.Goals["test"].VolumesFrom = []string{"otherTest"}
+
+	changed := old.Clone()
+	changed.Goals["otherTest"].Image = "alpine:3.3"
+
+	diff := old.Diff(changed)
+	require.Equal(t, []string{"otherTest", "test"}, diff.Recreated)
+}
+
+func TestDiffRecreatesGoalsWithChangedAliases(t *testing.T) {
+	old := validConfiguration.Clone()
+	old.Goals["test"].Links = []string{"otherTest:database"}
+
+	changed := old.Clone()
+	changed.Goals["test"].Links = []string{"otherTest:pg"}
+
+	diff := old.Diff(changed)
+	require.Equal(t, []string{"otherTest", "test"}, diff.Recreated)
+
+	added := old.Clone()
+	added.Goals["cache"] = &GoalConfiguration{Image: "alpine:3.2", Links: []string{"otherTest:cache"}}
+
+	diff = old.Diff(added)
+	require.Equal(t, []string{"otherTest", "test"}, diff.Recreated)
+	require.Equal(t, []string{"cache"}, diff.Added)
+}
+
+func TestApplicationConfigurationChecksResourceLimits(t *testing.T) {
+	copy := validConfiguration.Clone()
+	copy.Goals["test"].MemLimit = 1000
+	copy.Goals["test"].MemReservation = 2000
+	require.NotNil(t, copy.Validate())
+	require.Equal(t, `Goal "test": mem_reservation can't be greater than mem_limit`, copy.Validate().Error())
+
+	copy = validConfiguration.Clone()
+	copy.Goals["test"].BlkioWeight = 5
+	require.NotNil(t, copy.Validate())
+	require.Equal(t, `Goal "test": blkio_weight has to be between 10 and 1000`, copy.Validate().Error())
+
+	copy = validConfiguration.Clone()
+	copy.Goals["test"].Ulimits = map[string]*UlimitConfiguration{"nofile": {Soft: 200, Hard: 100}}
+	require.NotNil(t, copy.Validate())
+
+	copy.Goals["test"].Ulimits = map[string]*UlimitConfiguration{"files": {Soft: 100, Hard: 100}}
+	require.NotNil(t, copy.Validate())
+	require.Equal(t, `Goal "test": invalid ulimit type: files`, copy.Validate().Error())
+}
+
+func TestUlimitConfigurationUnmarshalsNumbersAndObjects(t *testing.T) {
+	ulimits := map[string]*UlimitConfiguration{}
+	err := json.Unmarshal([]byte(`{"nproc": 65535, "nofile": {"soft": 20000, "hard": 40000}}`), &ulimits)
+	require.Nil(t, err)
+	require.Equal(t, map[string]*UlimitConfiguration{
+		"nproc":  {Soft: 65535, Hard: 65535},
+		"nofile": {Soft: 20000, Hard: 40000},
+	}, ulimits)
+}
+
+func TestApplicationConfigurationChecksStopOptions(t *testing.T) {
+	copy := validConfiguration.Clone()
+	copy.Goals["test"].StopSignal = "SIGQUIT"
+	copy.Goals["test"].StopGracePeriod = Duration(time.Minute)
+	require.Nil(t, copy.Validate())
+
+	copy.Goals["test"].StopSignal = "sig quit"
+	require.NotNil(t, copy.Validate())
+	require.Equal(t, `Goal "test" has invalid stop signal "sig quit"`, copy.Validate().Error())
+
+	copy.Goals["test"].StopSignal = ""
+	copy.Goals["test"].StopGracePeriod = Duration(-time.Second)
+	require.NotNil(t, copy.Validate())
+	require.Equal(t, `Goal "test" has negative stop grace period`, copy.Validate().Error())
+}
+
+func TestDiffRecreatesGoalsMountingChangedVolumes(t *testing.T) {
+	old := validConfiguration.Clone()
+	old.Volumes = map[string]*VolumeConfiguration{"data": &VolumeConfiguration{Driver: "local"}, "cache": &VolumeConfiguration{}}
+	old.Goals["test"].Volumes = []string{"data:/data"}
+	old.Goals["otherTest"].Volumes = []string{"cache:/cache"}
+
+	changed := old.Clone()
+	changed.Volumes["data"].DriverOpts = map[string]string{"type": "tmpfs"}
+
+	diff := old.Diff(changed)
+	require.Equal(t, []string{"data"}, diff.ChangedVolumes)
+	require.Equal(t, []string{"test"}, diff.Recreated)
+	require.Equal(t, []string{"otherTest"}, diff.Kept)
+	require.Nil(t, old.checkVolumeChanges(changed))
+
+	changed.VolumePolicy = VolumePolicyKeep
+	require.Equal(t, ErrVolumeChanged, old.checkVolumeChanges(changed))
+
+	delete(changed.Volumes, "data")
+	changed.Goals["test"].Volumes = nil
+	require.Empty(t, old.ChangedVolumes(changed))
+	require.Nil(t, old.checkVolumeChanges(changed))
+}
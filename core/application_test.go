@@ -0,0 +1,130 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestoreKeepsExitedMainGoalExited(t *testing.T) {
+	for adopted, code := range map[string]int{"terminated": 0, "failed": 1} {
+		containerID := "4fa6e0f0c678"
+		exitCode := code
+		task := &Goal{Name: "task", CurrentStatus: adopted, ContainerId: &containerID, ExitCode: &exitCode, ImageExists: true}
+		application := &Application{Name: "app", MainGoal: "task", Goals: map[string]*Goal{"task": task}}
+
+		application.startMainGoal()
+
+		status := task.Status()
+		require.Equal(t, adopted, status.Status)
+		require.Equal(t, code, *status.ExitCode)
+		require.False(t, task.ShouldRun)
+	}
+}
+
+func TestUpdateKeepsTerminatedMainGoalTerminated(t *testing.T) {
+	task := newTestGoal(&GoalConfiguration{Image: "alpine:3.2"})
+	server := fakeDockerWithContainer(t, task, &types.ContainerState{Status: "exited"})
+	defer server.Close()
+	task.application.DockerClient = task.DockerClient
+	task.ImageExists = true
+	task.CurrentStatus = "terminated"
+
+	diff := task.application.Update(&ApplicationConfiguration{MainGoal: "web", Goals: map[string]*GoalConfiguration{"web": {Image: "alpine:3.2"}}})
+
+	require.Empty(t, diff.Recreated)
+	require.Equal(t, "terminated", task.Status().Status)
+	require.False(t, task.ShouldRun)
+}
+
+func TestRequestedStartKeepsFailedGoalFailed(t *testing.T) {
+	goal := newTestGoal(&GoalConfiguration{Image: "alpine:3.2"})
+	goal.ImageExists = true
+	goal.CurrentStatus = "failed"
+
+	goal.application.RequestGoalStart("web")
+
+	require.Equal(t, "failed", goal.Status().Status)
+	require.False(t, goal.ShouldRun)
+}
+
+func TestStoppingGoalsGivesUpWhenApplicationIsStartedAgain(t *testing.T) {
+	web := &Goal{Name: "web", CurrentStatus: "running", ShouldRun: true}
+	application := &Application{
+		Name:          "app",
+		MainGoal:      "web",
+		Configuration: &ApplicationConfiguration{MainGoal: "web", Goals: map[string]*GoalConfiguration{"web": &GoalConfiguration{Image: "alpine:3.2"}}},
+		Goals:         map[string]*Goal{"web": web},
+	}
+
+	application.stopGoals()
+
+	require.True(t, web.ShouldRun)
+	require.Equal(t, "running", web.Status().Status)
+}
+
+func TestStartGoalStartsExitedGoalAgain(t *testing.T) {
+	for _, status := range []string{"terminated", "failed", "error: could not start container"} {
+		goal := newTestGoal(&GoalConfiguration{Image: "alpine:3.2"})
+		dockerClient, err := client.NewClient("tcp://127.0.0.1:1", "1.24", nil, nil)
+		require.NoError(t, err)
+		goal.DockerClient = dockerClient
+		goal.ImageExists = true
+		goal.CurrentStatus = status
+
+		_, err = goal.application.StartGoal("web")
+		require.NoError(t, err)
+
+		entries := goal.TransitionLog()
+		require.True(t, len(entries) >= 2, status)
+		require.Equal(t, "stopped", entries[0].Status, status)
+		require.Equal(t, "starting", entries[1].Status, status)
+	}
+}
+
+func TestPauseAndUnpauseGoalReportStatusAfterTheAction(t *testing.T) {
+	goal := newTestGoal(&GoalConfiguration{Image: "alpine:3.2"})
+	server := fakeDockerWithContainer(t, goal, &types.ContainerState{Status: "running", Running: true})
+	defer server.Close()
+	containerID := "4fa6e0f0c678"
+	goal.ContainerId = &containerID
+	goal.CurrentStatus = "running"
+
+	status, err := goal.application.PauseGoal("web")
+	require.NoError(t, err)
+	require.Equal(t, "paused", status.Status)
+
+	status, err = goal.application.UnpauseGoal("web")
+	require.NoError(t, err)
+	require.Equal(t, "running", status.Status)
+
+	_, err = goal.application.UnpauseGoal("web")
+	require.Equal(t, ErrGoalNotPaused, err)
+}
+
+func TestUpdateWaitsUntilApplicationIsStopped(t *testing.T) {
+	goal := newTestGoal(&GoalConfiguration{Image: "alpine:3.2"})
+	server := fakeDockerWithContainer(t, goal, &types.ContainerState{Status: "exited"})
+	defer server.Close()
+	application := goal.application
+	application.DockerClient = goal.DockerClient
+
+	application.operation.Lock()
+	updated := make(chan ConfigurationDiff)
+	go func() {
+		updated <- application.Update(&ApplicationConfiguration{MainGoal: "web", Goals: map[string]*GoalConfiguration{"web": {Image: "alpine:3.2"}}})
+	}()
+
+	select {
+	case <-updated:
+		t.Fatal("update didn't wait for stopping of the application")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	application.operation.Unlock()
+	diff := <-updated
+	require.Equal(t, []string{"web"}, diff.Kept)
+}
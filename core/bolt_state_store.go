@@ -0,0 +1,245 @@
+package core
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/boltdb/bolt"
+)
+
+var (
+	applicationsBucket = []byte("applications")
+	revisionsBucket    = []byte("revisions")
+	statesBucket       = []byte("states")
+)
+
+// BoltStateStore keeps application descriptors in an embedded BoltDB
+// key/value database. Revisions are kept in a nested bucket per application,
+// keyed by the big endian encoded revision number.
+type BoltStateStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStateStore(fileName string) (*BoltStateStore, error) {
+	db, err := bolt.Open(fileName, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(applicationsBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(revisionsBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(statesBucket)
+		return err
+	})
+
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltStateStore{db: db}, nil
+}
+
+func (s *BoltStateStore) SaveApplication(name string, config *ApplicationConfiguration, user string) (Revision, error) {
+	err := ValidateApplicationName(name)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	var revision Revision
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		revisions, err := tx.Bucket(revisionsBucket).CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return err
+		}
+
+		number, err := revisions.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		revision = newRevision(int(number), config, user)
+
+		revisionData, err := json.Marshal(revision)
+		if err != nil {
+			return err
+		}
+
+		err = revisions.Put(revisionKey(revision.Number), revisionData)
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(applicationsBucket).Put([]byte(name), data)
+	})
+
+	if err != nil {
+		return Revision{}, err
+	}
+
+	return revision, nil
+}
+
+func (s *BoltStateStore) DeleteApplication(name string) error {
+	err := ValidateApplicationName(name)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(applicationsBucket).Delete([]byte(name))
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(statesBucket).Delete([]byte(name))
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(revisionsBucket).DeleteBucket([]byte(name))
+		if err == bolt.ErrBucketNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+func (s *BoltStateStore) Revisions(name string) ([]Revision, error) {
+	err := ValidateApplicationName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []Revision{}
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+		revisions := tx.Bucket(revisionsBucket).Bucket([]byte(name))
+		if revisions == nil {
+			return nil
+		}
+		return revisions.ForEach(func(k, v []byte) error {
+			revision := Revision{}
+			err := json.Unmarshal(v, &revision)
+			if err != nil {
+				return err
+			}
+			result = append(result, revision)
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (s *BoltStateStore) Revision(name string, number int) (Revision, error) {
+	err := ValidateApplicationName(name)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	revision := Revision{}
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+		revisions := tx.Bucket(revisionsBucket).Bucket([]byte(name))
+		if revisions == nil || number < 1 {
+			return ErrRevisionNotFound
+		}
+		data := revisions.Get(revisionKey(number))
+		if data == nil {
+			return ErrRevisionNotFound
+		}
+		return json.Unmarshal(data, &revision)
+	})
+
+	if err != nil {
+		return Revision{}, err
+	}
+
+	return revision, nil
+}
+
+func (s *BoltStateStore) SaveState(name string, state ApplicationState) error {
+	err := ValidateApplicationName(name)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(statesBucket).Put([]byte(name), data)
+	})
+}
+
+func (s *BoltStateStore) LoadState(name string) (ApplicationState, error) {
+	state := ApplicationState{}
+
+	err := ValidateApplicationName(name)
+	if err != nil {
+		return state, err
+	}
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(statesBucket).Get([]byte(name))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &state)
+	})
+
+	return state, err
+}
+
+func revisionKey(number int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(number))
+	return key
+}
+
+func (s *BoltStateStore) LoadApplications() (map[string]*ApplicationConfiguration, error) {
+	applications := map[string]*ApplicationConfiguration{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(applicationsBucket).ForEach(func(k, v []byte) error {
+			config := &ApplicationConfiguration{}
+			err := json.Unmarshal(v, config)
+			if err != nil {
+				log.Error("Could not parse descriptor of application ", string(k), ": ", err)
+				return nil
+			}
+			applications[string(k)] = config
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return applications, nil
+}
+
+func (s *BoltStateStore) Close() error {
+	return s.db.Close()
+}
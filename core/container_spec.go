@@ -0,0 +1,281 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+)
+
+// ContainerSpec holds everything needed to create the Docker container of a
+// goal.
+type ContainerSpec struct {
+	Name             string                    `json:"container_name"`
+	Config           *container.Config         `json:"config"`
+	HostConfig       *container.HostConfig     `json:"host_config"`
+	NetworkingConfig *network.NetworkingConfig `json:"networking_config"`
+	// Networks the container is connected to after it has been created.
+	Networks map[string]*network.EndpointSettings `json:"networks,omitempty"`
+}
+
+// NewContainerSpec resolves the goal configuration into configuration of the
+// Docker container that will be created for the goal. volumes are the named
+// volumes declared by the application.
+func NewContainerSpec(applicationName string, goalName string, configs map[string]*GoalConfiguration, volumes map[string]*VolumeConfiguration) *ContainerSpec {
+
+	config := configs[goalName]
+
+	spec := &ContainerSpec{
+		Config: &container.Config{
+			Image:        config.Image,
+			Cmd:          config.Command,
+			ExposedPorts: map[nat.Port]struct{}{},
+			Env:          []string{},
+			Labels:       config.Labels,
+			WorkingDir:   config.WorkingDir,
+			Entrypoint:   config.Entrypoint,
+			User:         config.User,
+			Hostname:     config.Hostname,
+			Domainname:   config.Domainname,
+			MacAddress:   config.MacAddress,
+			OpenStdin:    config.StdinOpen,
+			Tty:          config.Tty,
+			AttachStdin:  config.AttachStdin,
+			AttachStdout: config.AttachStdout,
+			AttachStderr: config.AttachStderr,
+			Healthcheck:  config.Healthcheck.dockerHealthConfig(),
+			StopSignal:   config.StopSignal,
+		},
+		HostConfig: &container.HostConfig{
+			ExtraHosts:     config.ExtraHosts,
+			PortBindings:   nat.PortMap{},
+			Binds:          []string{},
+			VolumeDriver:   config.VolumeDriver,
+			CapAdd:         config.CapAdd,
+			CapDrop:        config.CapDrop,
+			DNSSearch:      config.DNSSearch,
+			SecurityOpt:    config.SecurityOpt,
+			Privileged:     config.Privileged,
+			ReadonlyRootfs: config.ReadOnly,
+			ShmSize:        config.ShmSize,
+			Sysctls:        config.Sysctls,
+			OomScoreAdj:    config.OomScoreAdj,
+			Init:           config.Init,
+			Resources: container.Resources{
+				Devices:           []container.DeviceMapping{},
+				Memory:            config.MemLimit,
+				MemorySwap:        config.MemSwapLimit,
+				MemoryReservation: config.MemReservation,
+				CPUShares:         config.CpuShares,
+				CpusetCpus:        config.CpuSet,
+				CpusetMems:        config.CpusetMems,
+				NanoCPUs:          int64(config.Cpus * 1e9),
+				PidsLimit:         config.PidsLimit,
+				Ulimits:           config.dockerUlimits(),
+				BlkioWeight:       config.BlkioWeight,
+			},
+		},
+		NetworkingConfig: &network.NetworkingConfig{},
+		Networks:         map[string]*network.EndpointSettings{},
+	}
+
+	if config.StopGracePeriod > 0 {
+		stopTimeout := int(math.Ceil(time.Duration(config.StopGracePeriod).Seconds()))
+		spec.Config.StopTimeout = &stopTimeout
+	}
+
+	if config.OomKillDisable {
+		oomKillDisable := true
+		spec.HostConfig.OomKillDisable = &oomKillDisable
+	}
+
+	if config.Restart != "" {
+		// spec.HostConfig.RestartPolicy = docker.RestartPolicy{Name: config.Restart}
+		spec.HostConfig.RestartPolicy.Name = config.Restart
+	}
+
+	for _, deviceString := range config.Devices {
+		parts := strings.Split(deviceString, ":")
+		perm := "mrw"
+		hostDevice := parts[0]
+		containerDevice := parts[0]
+		if len(parts) == 3 {
+			perm = parts[2]
+			containerDevice = parts[1]
+		} else if len(parts) == 2 {
+			if len(parts[1]) > 3 {
+				containerDevice = parts[1]
+			} else {
+				containerDevice = parts[0]
+				perm = parts[1]
+			}
+		}
+
+		spec.HostConfig.Devices = append(spec.HostConfig.Devices, container.DeviceMapping{
+			PathOnHost:        hostDevice,
+			PathInContainer:   containerDevice,
+			CgroupPermissions: perm,
+		})
+	}
+
+	if len(config.Dns) != 0 {
+		spec.HostConfig.DNS = config.Dns
+	}
+
+	if config.Net != "" {
+		spec.HostConfig.NetworkMode = container.NetworkMode(config.Net)
+	}
+
+	if config.LogDriver != "" {
+		spec.HostConfig.LogConfig = container.LogConfig{
+			Type:   config.LogDriver,
+			Config: config.LogConfig,
+		}
+	}
+
+	for k, v := range config.Environment {
+		spec.Config.Env = append(spec.Config.Env, k+"="+v)
+	}
+
+	for _, volume := range config.Volumes {
+		spec.HostConfig.Binds = append(spec.HostConfig.Binds, volumeBind(applicationName, volumes, volume))
+	}
+
+	for _, volumesFrom := range config.VolumesFrom {
+		parts := strings.SplitN(volumesFrom, ":", 2)
+		from := containerName(applicationName, parts[0], configs[parts[0]].ContainerName)
+		if len(parts) == 2 {
+			from += ":" + parts[1]
+		}
+		spec.HostConfig.VolumesFrom = append(spec.HostConfig.VolumesFrom, from)
+	}
+
+	if len(config.Tmpfs) > 0 {
+		spec.HostConfig.Tmpfs = map[string]string{}
+		for _, tmpfs := range config.Tmpfs {
+			parts := strings.SplitN(tmpfs, ":", 2)
+			options := ""
+			if len(parts) == 2 {
+				options = parts[1]
+			}
+			spec.HostConfig.Tmpfs[parts[0]] = options
+		}
+	}
+
+	if config.Net == "" {
+		aliases := goalAliases(goalName, configs)
+
+		appNetwork := applicationNetworkName(applicationName)
+		if len(config.ExternalLinks) == 0 {
+			spec.HostConfig.NetworkMode = container.NetworkMode(appNetwork)
+			spec.NetworkingConfig.EndpointsConfig = map[string]*network.EndpointSettings{
+				appNetwork: &network.EndpointSettings{Aliases: aliases},
+			}
+		} else {
+			// legacy links to external containers work only on the default
+			// bridge network
+			spec.Networks[appNetwork] = &network.EndpointSettings{Aliases: aliases}
+		}
+
+		for _, name := range config.Networks {
+			spec.Networks[networkName(applicationName, name)] = &network.EndpointSettings{Aliases: aliases}
+		}
+	} else {
+		// goals with own network mode can only reach linked goals with
+		// legacy links
+		for _, lc := range config.LinkedContainers() {
+			spec.HostConfig.Links = append(spec.HostConfig.Links, containerName(applicationName, lc.Name, configs[lc.Name].ContainerName)+":"+lc.Alias)
+		}
+	}
+
+	for _, link := range config.ExternalLinks {
+		parts := strings.Split(link, ":")
+		name := parts[0]
+		alias := name
+		if len(parts) > 1 {
+			alias = parts[1]
+		}
+
+		spec.HostConfig.Links = append(spec.HostConfig.Links, name+":"+alias)
+
+	}
+
+	for _, port := range config.Ports {
+		protoParts := strings.Split(port, "/")
+
+		proto := "tcp"
+
+		if len(protoParts) == 2 {
+			proto = protoParts[1]
+		}
+
+		parts := strings.Split(protoParts[0], ":")
+
+		hostPort := ""
+
+		containerPort := parts[0]
+
+		if len(parts) == 2 {
+			hostPort = parts[0]
+			containerPort = parts[1]
+			portBinding := nat.PortBinding{HostPort: hostPort}
+			spec.HostConfig.PortBindings[nat.Port(containerPort+"/"+proto)] = []nat.PortBinding{portBinding}
+		} else {
+			spec.HostConfig.PortBindings[nat.Port(containerPort+"/"+proto)] = []nat.PortBinding{}
+		}
+
+	}
+
+	for _, port := range config.Expose {
+		protoParts := strings.Split(port, "/")
+
+		proto := "tcp"
+
+		if len(protoParts) == 2 {
+			proto = protoParts[1]
+		}
+
+		spec.Config.ExposedPorts[nat.Port(protoParts[0]+"/"+proto)] = struct{}{}
+
+	}
+
+	spec.Name = containerName(applicationName, goalName, config.ContainerName)
+
+	return spec
+}
+
+// goalAliases returns DNS aliases of the goal on application networks: the
+// goal name and all aliases other goals link it with.
+func goalAliases(goalName string, configs map[string]*GoalConfiguration) []string {
+	aliases := []string{goalName}
+	seen := map[string]bool{goalName: true}
+
+	names := []string{}
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, lc := range configs[name].LinkedContainers() {
+			if lc.Name == goalName && !seen[lc.Alias] {
+				seen[lc.Alias] = true
+				aliases = append(aliases, lc.Alias)
+			}
+		}
+	}
+
+	return aliases
+}
+
+func containerName(applicationName string, goalName string, configName string) string {
+	if configName != "" {
+		return configName
+	}
+	return fmt.Sprintf("ap_%s_%s", applicationName, goalName)
+}
@@ -0,0 +1,136 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	units "github.com/docker/go-units"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContainerSpecJoinsApplicationNetworks(t *testing.T) {
+	configs := map[string]*GoalConfiguration{
+		"db":  &GoalConfiguration{Image: "postgres:9.6", Networks: []string{"backend"}},
+		"web": &GoalConfiguration{Image: "rails:5", Links: []string{"db:database"}},
+	}
+
+	spec := NewContainerSpec("app", "db", configs, nil)
+	require.Equal(t, container.NetworkMode("ap_3_app"), spec.HostConfig.NetworkMode)
+	require.Equal(t, map[string]*network.EndpointSettings{
+		"ap_3_app": &network.EndpointSettings{Aliases: []string{"db", "database"}},
+	}, spec.NetworkingConfig.EndpointsConfig)
+	require.Equal(t, map[string]*network.EndpointSettings{
+		"ap_3_app_backend": &network.EndpointSettings{Aliases: []string{"db", "database"}},
+	}, spec.Networks)
+
+	spec = NewContainerSpec("app", "web", configs, nil)
+	require.Empty(t, spec.HostConfig.Links)
+}
+
+func TestContainerSpecUsesLinksWithOwnNetworkMode(t *testing.T) {
+	configs := map[string]*GoalConfiguration{
+		"db":  &GoalConfiguration{Image: "postgres:9.6"},
+		"web": &GoalConfiguration{Image: "rails:5", Links: []string{"db:database"}, Net: "bridge"},
+	}
+
+	spec := NewContainerSpec("app", "web", configs, nil)
+	require.Equal(t, container.NetworkMode("bridge"), spec.HostConfig.NetworkMode)
+	require.Equal(t, []string{"ap_app_db:database"}, spec.HostConfig.Links)
+	require.Nil(t, spec.NetworkingConfig.EndpointsConfig)
+}
+
+func TestContainerSpecWithExternalLinksConnectsApplicationNetworkLater(t *testing.T) {
+	configs := map[string]*GoalConfiguration{
+		"web": &GoalConfiguration{Image: "rails:5", ExternalLinks: []string{"test_container:test"}},
+	}
+
+	spec := NewContainerSpec("app", "web", configs, nil)
+	require.Equal(t, container.NetworkMode(""), spec.HostConfig.NetworkMode)
+	require.Equal(t, []string{"test_container:test"}, spec.HostConfig.Links)
+	require.Equal(t, map[string]*network.EndpointSettings{
+		"ap_3_app": &network.EndpointSettings{Aliases: []string{"web"}},
+	}, spec.Networks)
+}
+
+func TestContainerSpecMountsVolumes(t *testing.T) {
+	configs := map[string]*GoalConfiguration{
+		"data": &GoalConfiguration{Image: "alpine:3.2", ContainerName: "data_container"},
+		"web": &GoalConfiguration{
+			Image:        "rails:5",
+			Volumes:      []string{"/tmp", "/var/log:ro", "/srv:/srv:ro", "uploads:/uploads", "cache:/cache"},
+			VolumesFrom:  []string{"data:ro"},
+			Tmpfs:        []string{"/run", "/cache:size=64m"},
+			VolumeDriver: "local",
+		},
+	}
+
+	volumes := map[string]*VolumeConfiguration{"uploads": &VolumeConfiguration{}}
+
+	spec := NewContainerSpec("app", "web", configs, volumes)
+	require.Equal(t, []string{"/tmp:/tmp", "/var/log:/var/log:ro", "/srv:/srv:ro", "ap_3_app_uploads:/uploads", "cache:/cache"}, spec.HostConfig.Binds)
+	require.Equal(t, []string{"data_container:ro"}, spec.HostConfig.VolumesFrom)
+	require.Equal(t, map[string]string{"/run": "", "/cache": "size=64m"}, spec.HostConfig.Tmpfs)
+	require.Equal(t, "local", spec.HostConfig.VolumeDriver)
+}
+
+func TestContainerSpecSetsResourceLimits(t *testing.T) {
+	init := true
+	configs := map[string]*GoalConfiguration{
+		"web": &GoalConfiguration{
+			Image:          "rails:5",
+			MemLimit:       64000000,
+			CpuSet:         "0-1",
+			CpusetMems:     "0",
+			Cpus:           1.5,
+			MemReservation: 32000000,
+			PidsLimit:      100,
+			Ulimits:        map[string]*UlimitConfiguration{"nproc": {Soft: 65535, Hard: 65535}, "nofile": {Soft: 20000, Hard: 40000}},
+			ShmSize:        1000000,
+			Sysctls:        map[string]string{"net.core.somaxconn": "1024"},
+			OomScoreAdj:    500,
+			OomKillDisable: true,
+			BlkioWeight:    300,
+			Init:           &init,
+		},
+	}
+
+	hostConfig := NewContainerSpec("app", "web", configs, nil).HostConfig
+	require.Equal(t, "0-1", hostConfig.CpusetCpus)
+	require.Equal(t, "0", hostConfig.CpusetMems)
+	require.Equal(t, int64(1500000000), hostConfig.NanoCPUs)
+	require.Equal(t, int64(32000000), hostConfig.MemoryReservation)
+	require.Equal(t, int64(100), hostConfig.PidsLimit)
+	require.Equal(t, []*units.Ulimit{
+		{Name: "nofile", Soft: 20000, Hard: 40000},
+		{Name: "nproc", Soft: 65535, Hard: 65535},
+	}, hostConfig.Ulimits)
+	require.Equal(t, int64(1000000), hostConfig.ShmSize)
+	require.Equal(t, map[string]string{"net.core.somaxconn": "1024"}, hostConfig.Sysctls)
+	require.Equal(t, 500, hostConfig.OomScoreAdj)
+	require.True(t, *hostConfig.OomKillDisable)
+	require.Equal(t, uint16(300), hostConfig.BlkioWeight)
+	require.True(t, *hostConfig.Init)
+}
+
+func TestContainerSpecSetsStopSignalAndTimeout(t *testing.T) {
+	configs := map[string]*GoalConfiguration{
+		"db": &GoalConfiguration{Image: "postgres:9.6", StopSignal: "SIGINT", StopGracePeriod: Duration(90 * time.Second)},
+	}
+
+	config := NewContainerSpec("app", "db", configs, nil).Config
+	require.Equal(t, "SIGINT", config.StopSignal)
+	require.Equal(t, 90, *config.StopTimeout)
+
+	period := configs["db"].stopGracePeriod()
+	require.Equal(t, 90*time.Second, *period)
+}
+
+func TestNetworkAndVolumeNamesOfApplicationsDontCollide(t *testing.T) {
+	require.Equal(t, "ap_3_foo_bar", networkName("foo", "bar"))
+	require.Equal(t, "ap_7_foo_bar", applicationNetworkName("foo_bar"))
+	require.NotEqual(t, networkName("foo_bar", "db"), networkName("foo", "bar_db"))
+	require.NotEqual(t, networkName("foo", "bar"), applicationNetworkName("3_foo_bar"))
+	require.NotEqual(t, volumeName("foo_bar", "data"), volumeName("foo", "bar_data"))
+}
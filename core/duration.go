@@ -0,0 +1,46 @@
+package core
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Duration is a time.Duration that is (un)marshalled from/to JSON as a
+// duration string, e.g. "1m30s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+	return nil
+}
+
+// exponentialBackoff returns the delay before the attempt following the given
+// number of attempts. The delay doubles with every attempt until it reaches
+// the maximum.
+func exponentialBackoff(initial, max time.Duration, attempts int) time.Duration {
+	backoff := initial
+	for i := 0; i < attempts && backoff < max; i++ {
+		backoff *= 2
+	}
+
+	if backoff > max {
+		backoff = max
+	}
+
+	return backoff
+}
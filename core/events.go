@@ -0,0 +1,228 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Types of events published by the EventHub.
+const (
+	EventApplications          = "applications"
+	EventApplicationUpdate     = "application_update"
+	EventApplicationTerminated = "application_terminated"
+	EventGoalUpdate            = "goal_update"
+	EventGoalTransition        = "goal_transition"
+	EventGoalOutput            = "goal_output"
+	EventGoalStats             = "goal_stats"
+	EventGoalPullProgress      = "goal_pull_progress"
+	EventGoalTerminated        = "goal_terminated"
+)
+
+// EventTypes lists all types of events.
+var EventTypes = []string{
+	EventApplications,
+	EventApplicationUpdate,
+	EventApplicationTerminated,
+	EventGoalUpdate,
+	EventGoalTransition,
+	EventGoalOutput,
+	EventGoalStats,
+	EventGoalPullProgress,
+	EventGoalTerminated,
+}
+
+// EventHistorySize is the number of the most recent events kept to resume
+// subscriptions. Output, stats and pull progress of goals are not kept, so
+// that chatty goals don't push transitions out of the history.
+const EventHistorySize = 1000
+
+// subscriptionBuffer is the number of events a subscriber can fall behind
+// before it is disconnected.
+const subscriptionBuffer = 256
+
+// Event is a change of apparatchik, an application or a goal. Events of
+// goals carry both the name of the application and of the goal. IDs are
+// "<epoch>-<sequence>", the epoch is different for every apparatchik
+// process so that IDs seen before a restart are never mistaken for new ones.
+type Event struct {
+	ID          string      `json:"id"`
+	Time        time.Time   `json:"time"`
+	Type        string      `json:"type"`
+	Application string      `json:"application,omitempty"`
+	Goal        string      `json:"goal,omitempty"`
+	Data        interface{} `json:"data,omitempty"`
+	sequence    uint64
+}
+
+// resumable returns true for events kept in the history. Output, stats and
+// pull progress are only delivered to current subscribers.
+func (evt Event) resumable() bool {
+	return evt.Type != EventGoalOutput && evt.Type != EventGoalStats && evt.Type != EventGoalPullProgress
+}
+
+// EventFilter selects events by the application, the goal and the type.
+// Empty lists select all events. Events of applications and of apparatchik
+// don't match a filter with goals.
+type EventFilter struct {
+	Applications []string
+	Goals        []string
+	Types        []string
+}
+
+func (f EventFilter) matches(evt Event) bool {
+	if len(f.Applications) > 0 && !contains(f.Applications, evt.Application) {
+		return false
+	}
+	if len(f.Goals) > 0 && !contains(f.Goals, evt.Goal) {
+		return false
+	}
+	if len(f.Types) > 0 && !contains(f.Types, evt.Type) {
+		return false
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// EventHub numbers events and delivers them to subscribers. The most recent
+// events are kept, so that subscribers can resume after the last event they
+// have seen.
+type EventHub struct {
+	sync.Mutex
+	epoch        string
+	nextSequence uint64
+	history      []Event
+	// evicted is the sequence of the last event dropped from the history
+	evicted       uint64
+	subscriptions map[*EventSubscription]struct{}
+}
+
+func NewEventHub() *EventHub {
+	return &EventHub{
+		epoch:         strconv.FormatInt(time.Now().UnixNano(), 36),
+		nextSequence:  1,
+		subscriptions: map[*EventSubscription]struct{}{},
+	}
+}
+
+// Publish assigns the next ID to the event and delivers it to matching
+// subscribers. Subscribers that can't keep up are disconnected instead of
+// blocking the publisher.
+func (h *EventHub) Publish(evt Event) {
+	if h == nil {
+		return
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	evt.sequence = h.nextSequence
+	evt.ID = fmt.Sprintf("%s-%d", h.epoch, evt.sequence)
+	h.nextSequence++
+	if evt.Time.IsZero() {
+		evt.Time = time.Now()
+	}
+
+	if evt.resumable() {
+		h.history = append(h.history, evt)
+		if len(h.history) > EventHistorySize {
+			h.evicted = h.history[len(h.history)-EventHistorySize-1].sequence
+			h.history = h.history[len(h.history)-EventHistorySize:]
+		}
+	}
+
+	for subscription := range h.subscriptions {
+		if !subscription.filter.matches(evt) {
+			continue
+		}
+		select {
+		case subscription.events <- evt:
+		default:
+			h.unsubscribe(subscription)
+		}
+	}
+}
+
+// Subscribe returns a subscription to events matching the filter. When
+// resuming, kept events after lastEventID are delivered first. If events
+// after lastEventID are not kept any more or the ID is not known, for
+// example because apparatchik has been restarted, all kept events are
+// delivered.
+func (h *EventHub) Subscribe(filter EventFilter, resume bool, lastEventID string) *EventSubscription {
+	h.Lock()
+	defer h.Unlock()
+
+	replay := []Event{}
+	if resume {
+		lastSequence, known := h.sequenceOf(lastEventID)
+		for _, evt := range h.history {
+			if (!known || evt.sequence > lastSequence) && filter.matches(evt) {
+				replay = append(replay, evt)
+			}
+		}
+	}
+
+	subscription := &EventSubscription{
+		hub:    h,
+		filter: filter,
+		events: make(chan Event, len(replay)+subscriptionBuffer),
+	}
+
+	for _, evt := range replay {
+		subscription.events <- evt
+	}
+
+	h.subscriptions[subscription] = struct{}{}
+
+	return subscription
+}
+
+// sequenceOf returns the sequence of an event ID issued by this hub, if no
+// kept event after it has been dropped from the history since.
+func (h *EventHub) sequenceOf(id string) (uint64, bool) {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 || parts[0] != h.epoch {
+		return 0, false
+	}
+	sequence, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil || sequence >= h.nextSequence || sequence < h.evicted {
+		return 0, false
+	}
+	return sequence, true
+}
+
+func (h *EventHub) unsubscribe(subscription *EventSubscription) {
+	if _, found := h.subscriptions[subscription]; found {
+		delete(h.subscriptions, subscription)
+		close(subscription.events)
+	}
+}
+
+// EventSubscription receives events of the hub until it is closed.
+type EventSubscription struct {
+	hub    *EventHub
+	filter EventFilter
+	events chan Event
+}
+
+// Events returns the channel of events. The channel is closed when the
+// subscription is closed or the subscriber fell too far behind.
+func (s *EventSubscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *EventSubscription) Close() {
+	s.hub.Lock()
+	defer s.hub.Unlock()
+	s.hub.unsubscribe(s)
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func receive(t *testing.T, subscription *EventSubscription) []Event {
+	events := []Event{}
+	for {
+		select {
+		case evt, ok := <-subscription.Events():
+			if !ok {
+				return events
+			}
+			events = append(events, evt)
+		default:
+			return events
+		}
+	}
+}
+
+func eventSequences(events []Event) []uint64 {
+	sequences := []uint64{}
+	for _, evt := range events {
+		sequences = append(sequences, evt.sequence)
+	}
+	return sequences
+}
+
+func TestEventHubDeliversMatchingEvents(t *testing.T) {
+	hub := NewEventHub()
+	subscription := hub.Subscribe(EventFilter{Applications: []string{"app1"}, Types: []string{EventGoalUpdate}}, false, "")
+	defer subscription.Close()
+
+	hub.Publish(Event{Type: EventGoalUpdate, Application: "app1", Goal: "db"})
+	hub.Publish(Event{Type: EventGoalUpdate, Application: "app2", Goal: "db"})
+	hub.Publish(Event{Type: EventGoalOutput, Application: "app1", Goal: "db"})
+	hub.Publish(Event{Type: EventGoalUpdate, Application: "app1", Goal: "web"})
+
+	events := receive(t, subscription)
+	require.Equal(t, []uint64{1, 4}, eventSequences(events))
+	require.Equal(t, hub.epoch+"-4", events[1].ID)
+	require.Equal(t, "web", events[1].Goal)
+	require.False(t, events[1].Time.IsZero())
+}
+
+func TestEventFilterWithGoalsSkipsApplicationEvents(t *testing.T) {
+	filter := EventFilter{Goals: []string{"db"}}
+	require.True(t, filter.matches(Event{Type: EventGoalUpdate, Application: "app1", Goal: "db"}))
+	require.False(t, filter.matches(Event{Type: EventApplicationUpdate, Application: "app1"}))
+}
+
+func TestEventHubResumesAfterLastEventID(t *testing.T) {
+	hub := NewEventHub()
+	for i := 0; i < 5; i++ {
+		hub.Publish(Event{Type: EventGoalUpdate, Application: "app1", Goal: "db"})
+	}
+
+	subscription := hub.Subscribe(EventFilter{}, true, hub.epoch+"-3")
+	defer subscription.Close()
+	hub.Publish(Event{Type: EventGoalUpdate, Application: "app1", Goal: "db"})
+
+	require.Equal(t, []uint64{4, 5, 6}, eventSequences(receive(t, subscription)))
+}
+
+func TestEventHubReplaysAllKeptEventsForUnknownLastEventID(t *testing.T) {
+	hub := NewEventHub()
+	for i := 0; i < EventHistorySize+2; i++ {
+		hub.Publish(Event{Type: EventGoalUpdate, Application: "app1", Goal: "db"})
+	}
+
+	older := hub.Subscribe(EventFilter{}, true, hub.epoch+"-1")
+	defer older.Close()
+	events := receive(t, older)
+	require.Len(t, events, EventHistorySize)
+	require.Equal(t, uint64(3), events[0].sequence)
+
+	for _, id := range []string{hub.epoch + "-5000", "0", "previous-5", "previous-2000"} {
+		subscription := hub.Subscribe(EventFilter{}, true, id)
+		require.Len(t, receive(t, subscription), EventHistorySize, id)
+		subscription.Close()
+	}
+}
+
+func TestEventHubKeepsOnlyResumableEvents(t *testing.T) {
+	hub := NewEventHub()
+	hub.Publish(Event{Type: EventGoalTransition, Application: "app1", Goal: "db"})
+	for i := 0; i < EventHistorySize+1; i++ {
+		hub.Publish(Event{Type: EventGoalOutput, Application: "app1", Goal: "db"})
+		hub.Publish(Event{Type: EventGoalStats, Application: "app1", Goal: "db"})
+	}
+	hub.Publish(Event{Type: EventGoalTransition, Application: "app1", Goal: "db"})
+
+	subscription := hub.Subscribe(EventFilter{}, true, "0")
+	defer subscription.Close()
+	require.Equal(t, []uint64{1, 2*EventHistorySize + 4}, eventSequences(receive(t, subscription)))
+
+	resumed := hub.Subscribe(EventFilter{}, true, hub.epoch+"-5")
+	defer resumed.Close()
+	require.Equal(t, []uint64{2*EventHistorySize + 4}, eventSequences(receive(t, resumed)))
+}
+
+func TestEventHubDisconnectsSlowSubscribers(t *testing.T) {
+	hub := NewEventHub()
+	subscription := hub.Subscribe(EventFilter{}, false, "")
+
+	for i := 0; i < subscriptionBuffer+1; i++ {
+		hub.Publish(Event{Type: EventGoalOutput, Application: "app1", Goal: "db"})
+	}
+
+	require.Len(t, receive(t, subscription), subscriptionBuffer)
+	_, ok := <-subscription.Events()
+	require.False(t, ok)
+
+	subscription.Close()
+}
@@ -0,0 +1,292 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// FileStateStore keeps one JSON descriptor file per application in a
+// directory. Revisions of the application are stored as numbered JSON files
+// in a <name>.revisions sub directory and the runtime state in <name>.state.
+type FileStateStore struct {
+	dir string
+}
+
+func NewFileStateStore(dir string) (*FileStateStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStateStore{dir: dir}, nil
+}
+
+func (s *FileStateStore) fileName(name string) string {
+	return path.Join(s.dir, name+".json")
+}
+
+func (s *FileStateStore) revisionsDir(name string) string {
+	return path.Join(s.dir, name+".revisions")
+}
+
+func (s *FileStateStore) revisionFileName(name string, number int) string {
+	return path.Join(s.revisionsDir(name), strconv.Itoa(number)+".json")
+}
+
+func (s *FileStateStore) stateFileName(name string) string {
+	return path.Join(s.dir, name+".state")
+}
+
+func (s *FileStateStore) SaveApplication(name string, config *ApplicationConfiguration, user string) (Revision, error) {
+	err := ValidateApplicationName(name)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	numbers, err := s.revisionNumbers(name)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	number := 1
+	if len(numbers) > 0 {
+		number = numbers[len(numbers)-1] + 1
+	}
+
+	revision := newRevision(number, config, user)
+
+	err = os.MkdirAll(s.revisionsDir(name), 0755)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	data, err := json.Marshal(revision)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	err = writeFileAtomically(s.revisionFileName(name, number), data)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	data, err = json.Marshal(config)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	err = writeFileAtomically(s.fileName(name), data)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	return revision, nil
+}
+
+func (s *FileStateStore) DeleteApplication(name string) error {
+	err := ValidateApplicationName(name)
+	if err != nil {
+		return err
+	}
+
+	for _, fileName := range []string{s.fileName(name), s.stateFileName(name)} {
+		err = os.Remove(fileName)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return os.RemoveAll(s.revisionsDir(name))
+}
+
+func (s *FileStateStore) SaveState(name string, state ApplicationState) error {
+	err := ValidateApplicationName(name)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomically(s.stateFileName(name), data)
+}
+
+func (s *FileStateStore) LoadState(name string) (ApplicationState, error) {
+	state := ApplicationState{}
+
+	err := ValidateApplicationName(name)
+	if err != nil {
+		return state, err
+	}
+
+	data, err := ioutil.ReadFile(s.stateFileName(name))
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+
+	if err != nil {
+		return state, err
+	}
+
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+// revisionNumbers returns sorted numbers of all stored revisions of the
+// application.
+func (s *FileStateStore) revisionNumbers(name string) ([]int, error) {
+	files, err := ioutil.ReadDir(s.revisionsDir(name))
+	if os.IsNotExist(err) {
+		return []int{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	numbers := []int{}
+	for _, file := range files {
+		number, err := strconv.Atoi(strings.TrimSuffix(file.Name(), ".json"))
+		if err != nil || file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		numbers = append(numbers, number)
+	}
+
+	sort.Ints(numbers)
+
+	return numbers, nil
+}
+
+func (s *FileStateStore) Revisions(name string) ([]Revision, error) {
+	err := ValidateApplicationName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	numbers, err := s.revisionNumbers(name)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := []Revision{}
+	for _, number := range numbers {
+		revision, err := s.Revision(name, number)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, nil
+}
+
+func (s *FileStateStore) Revision(name string, number int) (Revision, error) {
+	err := ValidateApplicationName(name)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	data, err := ioutil.ReadFile(s.revisionFileName(name, number))
+	if os.IsNotExist(err) {
+		return Revision{}, ErrRevisionNotFound
+	}
+
+	if err != nil {
+		return Revision{}, err
+	}
+
+	revision := Revision{}
+	err = json.Unmarshal(data, &revision)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	return revision, nil
+}
+
+func (s *FileStateStore) LoadApplications() (map[string]*ApplicationConfiguration, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	applications := map[string]*ApplicationConfiguration{}
+
+	for _, file := range files {
+		fileName := file.Name()
+		if file.IsDir() || !strings.HasSuffix(fileName, ".json") {
+			continue
+		}
+
+		name := strings.TrimSuffix(fileName, ".json")
+		if ValidateApplicationName(name) != nil {
+			log.Warn("Ignoring state file with invalid application name ", fileName)
+			continue
+		}
+
+		data, err := ioutil.ReadFile(path.Join(s.dir, fileName))
+		if err != nil {
+			return nil, err
+		}
+
+		config := &ApplicationConfiguration{}
+		err = json.Unmarshal(data, config)
+		if err != nil {
+			log.Error("Could not parse descriptor of application ", name, ": ", err)
+			continue
+		}
+
+		applications[name] = config
+	}
+
+	return applications, nil
+}
+
+func (s *FileStateStore) Close() error {
+	return nil
+}
+
+// writeFileAtomically writes data to a temporary file in the same directory
+// and renames it to fileName, so that readers never see a partially written
+// file.
+func writeFileAtomically(fileName string, data []byte) error {
+	dir, base := path.Split(fileName)
+
+	tmp, err := ioutil.TempFile(dir, "."+base+".tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), fileName)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+
+	return err
+}
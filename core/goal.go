@@ -1,15 +1,11 @@
 package core
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"os"
-	"path"
 	"strings"
 	"sync"
 	"time"
@@ -20,22 +16,40 @@ import (
 	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
-	"github.com/docker/go-connections/nat"
 	"github.com/draganm/emission"
+	"github.com/netice9/apparatchik/core/logstore"
 	"github.com/netice9/apparatchik/core/stats"
 )
 
 const trackerHistorySize = 120
 
+// MaxTransitionLogEntries is the number of status transitions kept for each
+// goal.
+const MaxTransitionLogEntries = 100
+
+// TransitionLogEntry records when a goal changed to a status.
 type TransitionLogEntry struct {
 	Time   time.Time `json:"time"`
 	Status string    `json:"status"`
 }
 
 type GoalStatus struct {
-	Name     string `json:"name"`
-	Status   string `json:"status"`
-	ExitCode *int   `json:"exit_code,omitempty"`
+	Name          string        `json:"name"`
+	Status        string        `json:"status"`
+	ExitCode      *int          `json:"exit_code,omitempty"`
+	NextRetry     *time.Time    `json:"next_retry,omitempty"`
+	Health        string        `json:"health,omitempty"`
+	PullPolicy    string        `json:"pull_policy"`
+	ImageID       string        `json:"image_id,omitempty"`
+	PullProgress  *PullProgress `json:"pull_progress,omitempty"`
+	PullAttempt   int           `json:"pull_attempt,omitempty"`
+	LastPullError string        `json:"last_pull_error,omitempty"`
+	OOMKilled     bool          `json:"oom_killed,omitempty"`
+	Error         string        `json:"error,omitempty"`
+	StartedAt     *time.Time    `json:"started_at,omitempty"`
+	FinishedAt    *time.Time    `json:"finished_at,omitempty"`
+	RestartCount  int           `json:"restart_count"`
+	ContainerID   string        `json:"container_id,omitempty"`
 }
 
 type Goal struct {
@@ -48,24 +62,62 @@ type Goal struct {
 	Goals                map[string]*Goal
 	RunAfterStatuses     map[string]string
 	LinksStatuses        map[string]string
+	VolumesFromStatuses  map[string]string
+	HealthyLinks         map[string]bool
 	UpstreamGoalStatuses map[string]string
 	ShouldRun            bool
 	ImageExists          bool
 	AuthConfig           AuthConfiguration
 	SmartRestart         bool
 
+	configuration *GoalConfiguration
+
+	// removeVolumes is set when volumes of the container are removed
+	// together with it.
+	removeVolumes bool
+
+	// restarts counts consecutive smart restarts, restartCount all smart
+	// restarts of the goal. startedAt and finishedAt are the times when the
+	// container was started and exited last time.
+	restarts     int
+	restartCount int
+	startedAt    time.Time
+	finishedAt   time.Time
+	restartTimer *time.Timer
+	nextRetry    *time.Time
+
+	// oomKilled and exitError describe why the container exited last time.
+	oomKilled bool
+	exitError string
+
+	// health is reported by the native health check of the container.
+	health string
+
+	pullPolicy string
+	imageID    string
+
+	pullProgress        *PullProgress
+	pullProgressEmitted time.Time
+
+	pullAttempt   int
+	lastPullError string
+	pullTimer     *time.Timer
+
 	containerName    string
 	containerConfig  *container.Config
 	hostConfig       *container.HostConfig
 	networkingConfig *network.NetworkingConfig
+	networks         map[string]*network.EndpointSettings
 
 	ContainerId *string
 	ExitCode    *int
 
 	*emission.Emitter
 
-	tail    []string
-	tracker *stats.Tracker
+	tail          []string
+	tracker       *stats.Tracker
+	currentStats  *types.StatsJSON
+	transitionLog []TransitionLogEntry
 }
 
 type GoalEvent struct {
@@ -91,15 +143,28 @@ func (g *Goal) AddLineToTail(line string) {
 	g.EmitAsync("tail", strings.Join(g.tail, ""))
 }
 
+// TerminateGoal gracefully stops the container of the goal, waits until it
+// has exited and removes it.
 func (goal *Goal) TerminateGoal() {
-	if goal.ContainerId != nil {
-		containerID := *goal.ContainerId
-		err := goal.DockerClient.ContainerRemove(context.Background(), containerID, types.ContainerRemoveOptions{RemoveVolumes: true, Force: true})
+	goal.Lock()
+	goal.ShouldRun = false
+	goal.cancelRestart()
+	goal.cancelPullRetry()
+	containerID := goal.ContainerId
+	goal.Unlock()
+	if containerID != nil {
+		err := goal.stopContainer(*containerID)
+		if err != nil {
+			log.Error("Could not stop container of goal ", goal.Name, ": ", err)
+		}
+		goal.storeRunExit(*containerID)
+		err = goal.DockerClient.ContainerRemove(context.Background(), *containerID, types.ContainerRemoveOptions{RemoveVolumes: goal.removeVolumes, Force: true})
 		if err != nil {
 			log.Error(err)
 		}
 	}
 	goal.EmitAsync("terminated")
+	goal.application.publishEvent(Event{Type: EventGoalTerminated, Goal: goal.Name})
 }
 
 func (goal *Goal) SetCurrentStatus(status string) {
@@ -113,12 +178,44 @@ func (goal *Goal) setCurrentStatus(status string) {
 
 	log.Debug("setting current status of goal ", goal.Name, " to ", status)
 
+	if status != goal.CurrentStatus {
+		goal.recordTransition(status)
+		goal.application.EmitAsync("transition", goal.Name)
+		goal.application.publishEvent(Event{Type: EventGoalTransition, Goal: goal.Name, Data: goal.transitionLog[len(goal.transitionLog)-1]})
+	}
+
 	go goal.application.GoalStatusUpdate(goal.Name, status)
 
 	goal.CurrentStatus = status
 
 }
 
+func (goal *Goal) recordTransition(status string) {
+	goal.transitionLog = append(goal.transitionLog, TransitionLogEntry{Time: time.Now(), Status: status})
+	if len(goal.transitionLog) > MaxTransitionLogEntries {
+		goal.transitionLog = goal.transitionLog[len(goal.transitionLog)-MaxTransitionLogEntries:]
+	}
+}
+
+// TransitionLog returns the last status transitions of the goal, oldest
+// first.
+func (goal *Goal) TransitionLog() []TransitionLogEntry {
+	goal.Lock()
+	defer goal.Unlock()
+	return append([]TransitionLogEntry{}, goal.transitionLog...)
+}
+
+// restoreTransitionLog continues the transition log persisted by a previous
+// apparatchik process.
+func (goal *Goal) restoreTransitionLog(entries []TransitionLogEntry) {
+	goal.Lock()
+	defer goal.Unlock()
+	goal.transitionLog = append(append([]TransitionLogEntry{}, entries...), goal.transitionLog...)
+	if len(goal.transitionLog) > MaxTransitionLogEntries {
+		goal.transitionLog = goal.transitionLog[len(goal.transitionLog)-MaxTransitionLogEntries:]
+	}
+}
+
 func (goal *Goal) FetchImageFailed(reason string) {
 	goal.SetCurrentStatus("error: " + reason)
 }
@@ -129,21 +226,21 @@ func (goal *Goal) FetchImageFinished() {
 	goal.ImageExists = true
 	if goal.canRun() {
 		goal.startContainer()
-	} else {
+	} else if goal.CurrentStatus != "stopped" {
 		goal.setCurrentStatus("waiting_for_dependencies")
 	}
 }
 
 func (goal *Goal) shouldStop() bool {
 
-	isRunning := goal.CurrentStatus == "running"
+	isRunning := IsRunningStatus(goal.CurrentStatus) || goal.CurrentStatus == "paused"
 
 	if isRunning && !goal.ShouldRun {
 		return true
 	}
 
 	for _, status := range goal.LinksStatuses {
-		if isRunning && status != "running" {
+		if isRunning && !IsRunningStatus(status) && status != "paused" {
 			return true
 		}
 	}
@@ -152,6 +249,27 @@ func (goal *Goal) shouldStop() bool {
 
 }
 
+// IsRunningStatus returns true for statuses of goals with a running
+// container.
+func IsRunningStatus(status string) bool {
+	return status == "running" || status == "healthy" || status == "unhealthy"
+}
+
+// linkReady returns true when the linked goal is ready to be used by this
+// goal. Links can wait either for the goal to run or for it to be healthy.
+func (goal *Goal) linkReady(goalName, status string) bool {
+	if goal.HealthyLinks[goalName] {
+		return status == "healthy"
+	}
+	return IsRunningStatus(status)
+}
+
+// volumesFromReady returns true when the container of a goal other goals
+// mount volumes from has been created.
+func volumesFromReady(status string) bool {
+	return IsRunningStatus(status) || status == "paused" || status == "terminated"
+}
+
 func (goal *Goal) canRun() bool {
 
 	if !goal.ShouldRun {
@@ -167,15 +285,21 @@ func (goal *Goal) canRun() bool {
 			return false
 		}
 	}
-	for _, status := range goal.LinksStatuses {
-		if status != "running" {
+	for name, status := range goal.LinksStatuses {
+		if !goal.linkReady(name, status) {
+			return false
+		}
+	}
+	for _, status := range goal.VolumesFromStatuses {
+		if !volumesFromReady(status) {
 			return false
 		}
 	}
 	return goal.CurrentStatus == "waiting_for_dependencies" ||
 		goal.CurrentStatus == "fetching_image" ||
+		goal.CurrentStatus == "stopped" ||
 		// goal.CurrentStatus == "terminated" ||
-		(goal.CurrentStatus == "failed" && goal.SmartRestart)
+		(goal.CurrentStatus == "failed" && goal.SmartRestart && !goal.restartsExhausted())
 
 }
 
@@ -185,46 +309,262 @@ func (goal *Goal) HandleDockerEvent(evt events.Message) {
 	goal.handleDockerEvent(evt)
 }
 
-func (goal *Goal) SetExitCode(exitCode int) {
+// SetExitCode records the state of the exited container and updates the
+// status of the goal accordingly.
+func (goal *Goal) SetExitCode(state *types.ContainerState) {
 	goal.Lock()
 	defer goal.Unlock()
-	goal.ExitCode = &exitCode
-	if exitCode == 0 {
+	goal.recordExitState(state)
+	exitCode := state.ExitCode
+	if goal.CurrentStatus == "stopping" || goal.CurrentStatus == "stopped" {
+		goal.setCurrentStatus("stopped")
+	} else if exitCode == 0 {
 		goal.setCurrentStatus("terminated")
 	} else {
 		goal.setCurrentStatus("failed")
-		if goal.canRun() {
-			goal.startContainer()
+		if goal.SmartRestart {
+			goal.scheduleRestart()
 		}
 	}
 
 }
 
-func (goal *Goal) startTailingLog() {
+// scheduleRestart restarts the failed goal after a backoff that grows with
+// every consecutive restart. The goal is in the crash_loop_backoff status
+// until then. Consecutive restarts are forgotten when the container ran
+// longer than the reset window, after too many restarts the goal stays
+// failed.
+func (goal *Goal) scheduleRestart() {
+	if !goal.startedAt.IsZero() && time.Since(goal.startedAt) >= goal.configuration.restartResetWindow() {
+		goal.restarts = 0
+	}
+
+	if goal.restartsExhausted() {
+		go goal.AddLineToTail(fmt.Sprintf("Giving up after %d restarts\n", goal.restarts))
+		return
+	}
+
+	if !goal.canRun() {
+		return
+	}
+
+	backoff := goal.configuration.restartBackoff(goal.restarts)
+	goal.restarts++
+	goal.restartCount++
+
+	nextRetry := time.Now().Add(backoff)
+	goal.nextRetry = &nextRetry
+	goal.setCurrentStatus("crash_loop_backoff")
+	goal.broadcastStatus()
+
+	goal.restartTimer = time.AfterFunc(backoff, goal.retryRestart)
+}
+
+func (goal *Goal) retryRestart() {
+	goal.Lock()
+	defer goal.Unlock()
+
+	if goal.CurrentStatus != "crash_loop_backoff" {
+		return
+	}
+
+	goal.restartTimer = nil
+	goal.nextRetry = nil
+
+	goal.setCurrentStatus("waiting_for_dependencies")
+	if goal.canRun() {
+		goal.startContainer()
+	}
+	goal.broadcastStatus()
+}
+
+// cancelRestart cancels a scheduled smart restart.
+func (goal *Goal) cancelRestart() {
+	if goal.restartTimer != nil {
+		goal.restartTimer.Stop()
+		goal.restartTimer = nil
+	}
+	goal.nextRetry = nil
+}
+
+// resetRestarts forgets consecutive smart restarts of the goal, so that a
+// goal that gave up or is backing off can be started right away. Only
+// starts requested by the user reset the restarts.
+func (goal *Goal) resetRestarts() {
+	goal.Lock()
+	defer goal.Unlock()
+	goal.restarts = 0
+	if goal.CurrentStatus == "crash_loop_backoff" {
+		goal.cancelRestart()
+		goal.setCurrentStatus("waiting_for_dependencies")
+	}
+}
+
+// exited returns true when the container of the goal exited, or could not
+// be started, and the goal won't run again until the user starts it.
+func (goal *Goal) exited() bool {
+	switch {
+	case goal.CurrentStatus == "terminated", strings.HasPrefix(goal.CurrentStatus, "error: "):
+		return true
+	case goal.CurrentStatus == "failed":
+		return !goal.SmartRestart || goal.restartsExhausted()
+	}
+	return false
+}
+
+// Exited returns true when the container of the goal exited, or could not
+// be started, and the goal won't run again until the user starts it.
+func (goal *Goal) Exited() bool {
+	goal.Lock()
+	defer goal.Unlock()
+	return goal.exited()
+}
+
+// rearm lets an exited goal be started again. Goals that failed to pull their
+// image pull it again, other exited goals are set to stopped. Only starts
+// requested by the user rearm goals.
+func (goal *Goal) rearm() {
+	goal.Lock()
+	defer goal.Unlock()
+
+	if !goal.exited() {
+		return
+	}
+
+	if goal.pullFailedStatus() {
+		goal.retryPull()
+		return
+	}
+
+	goal.setCurrentStatus("stopped")
+	goal.broadcastStatus()
+}
+
+func (goal *Goal) restartsExhausted() bool {
+	maxAttempts := goal.configuration.RestartMaxAttempts
+	return maxAttempts > 0 && goal.restarts >= maxAttempts
+}
+
+func (goal *Goal) startTailingLog(containerID string, startedAt time.Time) {
 
 	goal.AddLineToTail("----------\n")
-	goal.AddLineToTail(fmt.Sprintf("Container with ID %q started\n", *goal.ContainerId))
-	rc, err := goal.DockerClient.ContainerLogs(context.Background(), *goal.ContainerId, types.ContainerLogsOptions{
-		ShowStdout: true,
-		ShowStderr: true,
-		Timestamps: true,
-		Follow:     true,
-		Details:    false,
-	})
+	goal.AddLineToTail(fmt.Sprintf("Container with ID %q started\n", containerID))
+
+	goal.Lock()
+	tty := goal.containerConfig.Tty
+	goal.Unlock()
+
+	stream, err := openLogStream(context.Background(), goal.DockerClient, containerID, tty, LogOptions{Stdout: true, Stderr: true, Follow: true})
 	if err != nil {
 		goal.AddLineToTail("Could not tail output: " + err.Error() + "\n")
+		return
 	}
-	br := bufio.NewReader(rc)
-	defer rc.Close()
+	defer stream.Close()
+
+	run := goal.startRun(containerID, startedAt)
 	for {
-		line, err := br.ReadString('\n')
+		line, err := stream.Next()
 		if err != nil {
 			goal.AddLineToTail("output closed...\n")
+			goal.finishRun(run, containerID)
 			return
 		}
-		goal.AddLineToTail(line[8:])
+		goal.AddLineToTail(line.Format(true))
+		goal.recordLine(run, line)
+		goal.application.publishEvent(Event{Type: EventGoalOutput, Goal: goal.Name, Data: line})
+	}
+
+}
+
+// archiveRun stores output of a container that exited while apparatchik
+// was not watching it.
+func (goal *Goal) archiveRun(containerID string, tty bool, startedAt time.Time) {
+	run := goal.startRun(containerID, startedAt)
+	if run == nil {
+		return
+	}
+
+	stream, err := openLogStream(context.Background(), goal.DockerClient, containerID, tty, LogOptions{Stdout: true, Stderr: true})
+	if err != nil {
+		log.Error("Goal ", goal.Name, " could not read output of container ", containerID, ": ", err)
+		run.Close()
+		return
+	}
+	defer stream.Close()
+
+	for {
+		line, err := stream.Next()
+		if err != nil {
+			goal.finishRun(run, containerID)
+			return
+		}
+		goal.recordLine(run, line)
+	}
+}
+
+// startRun starts recording output of the container in the LogStore.
+func (goal *Goal) startRun(containerID string, startedAt time.Time) *logstore.RunWriter {
+	if LogStore == nil {
+		return nil
+	}
+	run, err := LogStore.StartRun(goal.ApplicationName, goal.Name, containerID, startedAt)
+	if err != nil {
+		log.Error("Goal ", goal.Name, " could not store output of container ", containerID, ": ", err)
+		return nil
+	}
+	return run
+}
+
+func (goal *Goal) recordLine(run *logstore.RunWriter, line LogLine) {
+	if run == nil {
+		return
+	}
+	err := run.Write(logstore.Line(line))
+	if err != nil {
+		log.Error("Goal ", goal.Name, " could not store output: ", err)
+	}
+}
+
+// finishRun stops recording output of the container and records its exit.
+func (goal *Goal) finishRun(run *logstore.RunWriter, containerID string) {
+	if run == nil {
+		return
+	}
+	run.Close()
+	goal.storeRunExit(containerID)
+}
+
+// storeRunExit records the exit code of the container in the LogStore. It is
+// called before containers are removed, because their exit can't be
+// inspected afterwards. Containers that are still running are ignored.
+func (goal *Goal) storeRunExit(containerID string) {
+	if LogStore == nil {
+		return
+	}
+
+	container, err := goal.DockerClient.ContainerInspect(context.Background(), containerID)
+	if err != nil || container.State.Running || container.State.Paused {
+		return
 	}
 
+	err = LogStore.FinishRun(goal.ApplicationName, goal.Name, containerID, parseDockerTime(container.State.StartedAt), parseDockerTime(container.State.FinishedAt), container.State.ExitCode)
+	if err != nil {
+		log.Error("Goal ", goal.Name, " could not store exit of container ", containerID, ": ", err)
+	}
+}
+
+// OpenLogs starts reading output of the current container of the goal.
+func (goal *Goal) OpenLogs(ctx context.Context, options LogOptions) (*LogStream, error) {
+	goal.Lock()
+	containerID := goal.ContainerId
+	tty := goal.containerConfig.Tty
+	goal.Unlock()
+
+	if containerID == nil {
+		return nil, ErrGoalHasNoContainer
+	}
+
+	return openLogStream(ctx, goal.DockerClient, *containerID, tty, options)
 }
 
 func (goal *Goal) startTrackingContainer() {
@@ -258,22 +598,100 @@ func (goal *Goal) AddStats(st types.StatsJSON) {
 	goal.Lock()
 	defer goal.Unlock()
 
-	goal.tracker.Add(stats.Entry{
-		Time:   st.Read,
-		CPU:    st.CPUStats.CPUUsage.TotalUsage - st.PreCPUStats.CPUUsage.TotalUsage,
-		Memory: st.MemoryStats.Usage,
-	})
+	goal.currentStats = &st
+	goal.tracker.Add(statsEntry(st))
 	goal.EmitAsync("stats", goal.tracker.Entries())
+	goal.application.publishEvent(Event{Type: EventGoalStats, Goal: goal.Name, Data: goal.tracker.LastEntry()})
+}
+
+// ErrGoalHasNoStats is returned for goals whose container hasn't reported
+// its resource usage yet.
+var ErrGoalHasNoStats = errors.New("Goal has no stats")
+
+// CurrentStats returns the last resource usage reported by Docker for the
+// container of the goal.
+func (goal *Goal) CurrentStats() (types.StatsJSON, error) {
+	goal.Lock()
+	defer goal.Unlock()
+	if goal.currentStats == nil {
+		return types.StatsJSON{}, ErrGoalHasNoStats
+	}
+	return *goal.currentStats, nil
+}
+
+// StatsSince returns resource usage sampled after the time.
+func (goal *Goal) StatsSince(since time.Time) []stats.Entry {
+	goal.Lock()
+	defer goal.Unlock()
+	return goal.tracker.EntriesSince(since)
+}
+
+// statsEntry converts stats reported by docker. CPU percentage is the share
+// of the host CPU time used by the container, multiplied by the number of
+// online CPUs so that 100% is one fully used CPU.
+func statsEntry(st types.StatsJSON) stats.Entry {
+	entry := stats.Entry{
+		Time:        st.Read,
+		CPU:         st.CPUStats.CPUUsage.TotalUsage - st.PreCPUStats.CPUUsage.TotalUsage,
+		Memory:      st.MemoryStats.Usage,
+		MemoryLimit: st.MemoryStats.Limit,
+		MemoryCache: st.MemoryStats.Stats["cache"],
+		Pids:        st.PidsStats.Current,
+	}
+
+	onlineCPUs := uint64(st.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = uint64(len(st.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if st.CPUStats.SystemUsage > st.PreCPUStats.SystemUsage && st.CPUStats.CPUUsage.TotalUsage >= st.PreCPUStats.CPUUsage.TotalUsage {
+		systemDelta := float64(st.CPUStats.SystemUsage - st.PreCPUStats.SystemUsage)
+		entry.CPUPercent = float64(entry.CPU) / systemDelta * float64(onlineCPUs) * 100
+	}
+
+	for _, network := range st.Networks {
+		entry.NetworkRx += network.RxBytes
+		entry.NetworkTx += network.TxBytes
+	}
+
+	for _, blkio := range st.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(blkio.Op) {
+		case "read":
+			entry.BlockRead += blkio.Value
+		case "write":
+			entry.BlockWrite += blkio.Value
+		}
+	}
+
+	return entry
 }
 
 func (goal *Goal) handleDockerEvent(evt events.Message) {
 	if goal.ContainerId != nil && evt.ID == *goal.ContainerId {
 		if evt.Status == "start" {
+			goal.startedAt = time.Now()
+			goal.health = ""
+			goal.oomKilled = false
+			goal.exitError = ""
 			goal.setCurrentStatus("running")
 
-			go goal.startTailingLog()
+			go goal.startTailingLog(*goal.ContainerId, goal.startedAt)
 			go goal.startTrackingContainer()
+			go goal.startHealthChecking(*goal.ContainerId)
+
+		}
 
+		if strings.HasPrefix(evt.Status, "health_status: ") {
+			goal.handleHealthStatus(strings.TrimPrefix(evt.Status, "health_status: "))
+		}
+
+		if evt.Status == "pause" {
+			goal.setCurrentStatus("paused")
+			goal.broadcastStatus()
+		}
+
+		if evt.Status == "unpause" {
+			goal.setCurrentStatus("running")
+			goal.broadcastStatus()
 		}
 
 		if evt.Status == "die" {
@@ -284,7 +702,7 @@ func (goal *Goal) handleDockerEvent(evt events.Message) {
 					goal.SetCurrentStatus("error: " + err.Error())
 					return
 				}
-				goal.SetExitCode(container.State.ExitCode)
+				goal.SetExitCode(container.State)
 
 			}()
 		}
@@ -316,23 +734,140 @@ func (goal *Goal) findContainerIdByName(name string) (*types.Container, error) {
 	return nil, nil
 }
 
-func containerName(applicationName string, goalName string, configName string) string {
-	if configName != "" {
-		return configName
-	}
-	return fmt.Sprintf("ap_%s_%s", applicationName, goalName)
-}
-
 func (goal *Goal) StopContainer() {
 	goal.SetCurrentStatus("stopping_container")
 	go func() {
-		err := goal.DockerClient.ContainerStop(context.Background(), *goal.ContainerId, nil)
+		err := goal.stopContainer(*goal.ContainerId)
 		if err != nil {
 			goal.SetCurrentStatus("error: " + err.Error())
 		}
 	}()
 }
 
+// markStopped sets status of a goal that is not running to stopped, without
+// notifying the siblings.
+func (goal *Goal) markStopped() {
+	goal.Lock()
+	defer goal.Unlock()
+	goal.ShouldRun = false
+	if !IsRunningStatus(goal.CurrentStatus) {
+		goal.CurrentStatus = "stopped"
+	}
+}
+
+// Stop gracefully stops the container of the goal and waits until it has
+// exited. The goal won't be started again until Start() is called.
+func (goal *Goal) Stop() {
+	goal.halt(goal.stopContainer)
+}
+
+// stopContainer sends the stop signal of the goal to the container and kills
+// it when it has not exited within the stop grace period.
+func (goal *Goal) stopContainer(containerID string) error {
+	return goal.DockerClient.ContainerStop(context.Background(), containerID, goal.configuration.stopGracePeriod())
+}
+
+// Kill kills the container of the goal with SIGKILL. Like with Stop(), the
+// goal won't be started again until Start() is called.
+func (goal *Goal) Kill() {
+	goal.halt(func(containerID string) error {
+		return goal.DockerClient.ContainerKill(context.Background(), containerID, "SIGKILL")
+	})
+}
+
+// Restart stops the container of the goal and starts it again.
+func (goal *Goal) Restart() {
+	goal.Stop()
+	goal.rearm()
+	goal.Start()
+}
+
+func (goal *Goal) halt(stop func(containerID string) error) {
+	goal.Lock()
+
+	goal.ShouldRun = false
+	goal.cancelRestart()
+	containerID := goal.ContainerId
+	isRunning := IsRunningStatus(goal.CurrentStatus) || goal.CurrentStatus == "paused" || goal.CurrentStatus == "stopping_container"
+
+	if containerID == nil || !isRunning {
+		goal.setCurrentStatus("stopped")
+		goal.broadcastStatus()
+		goal.Unlock()
+		return
+	}
+
+	goal.setCurrentStatus("stopping")
+	goal.broadcastStatus()
+	goal.Unlock()
+
+	err := stop(*containerID)
+
+	goal.Lock()
+	defer goal.Unlock()
+
+	if err != nil {
+		goal.setCurrentStatus("error: " + err.Error())
+	} else {
+		goal.setCurrentStatus("stopped")
+	}
+	goal.broadcastStatus()
+}
+
+// Pause freezes all processes of the running container of the goal.
+func (goal *Goal) Pause() error {
+	goal.Lock()
+	containerID := goal.ContainerId
+	isRunning := IsRunningStatus(goal.CurrentStatus)
+	goal.Unlock()
+
+	if containerID == nil || !isRunning {
+		return ErrGoalNotRunning
+	}
+
+	err := goal.DockerClient.ContainerPause(context.Background(), *containerID)
+	if err != nil {
+		return err
+	}
+
+	goal.containerStatusChanged(*containerID, IsRunningStatus, "paused")
+	return nil
+}
+
+// Unpause resumes processes of the paused container of the goal.
+func (goal *Goal) Unpause() error {
+	goal.Lock()
+	containerID := goal.ContainerId
+	isPaused := goal.CurrentStatus == "paused"
+	goal.Unlock()
+
+	if containerID == nil || !isPaused {
+		return ErrGoalNotPaused
+	}
+
+	err := goal.DockerClient.ContainerUnpause(context.Background(), *containerID)
+	if err != nil {
+		return err
+	}
+
+	goal.containerStatusChanged(*containerID, func(status string) bool { return status == "paused" }, "running")
+	return nil
+}
+
+// containerStatusChanged sets the status of the goal right after Docker
+// changed the state of its container, without waiting for the Docker event.
+// The status is kept when the container was replaced or its status changed
+// meanwhile.
+func (goal *Goal) containerStatusChanged(containerID string, expected func(string) bool, status string) {
+	goal.Lock()
+	defer goal.Unlock()
+	if goal.ContainerId == nil || *goal.ContainerId != containerID || !expected(goal.CurrentStatus) {
+		return
+	}
+	goal.setCurrentStatus(status)
+	goal.broadcastStatus()
+}
+
 func (goal *Goal) startContainer() {
 
 	goal.setCurrentStatus("starting")
@@ -347,7 +882,8 @@ func (goal *Goal) startContainer() {
 		}
 
 		if existingContainer != nil {
-			err = goal.DockerClient.ContainerRemove(context.Background(), existingContainer.ID, types.ContainerRemoveOptions{Force: true, RemoveVolumes: true})
+			goal.storeRunExit(existingContainer.ID)
+			err = goal.DockerClient.ContainerRemove(context.Background(), existingContainer.ID, types.ContainerRemoveOptions{Force: true, RemoveVolumes: goal.removeVolumes})
 			if err != nil {
 				goal.SetCurrentStatus("error: " + err.Error())
 				return
@@ -363,6 +899,14 @@ func (goal *Goal) startContainer() {
 
 		goal.SetContainerID(container.ID)
 
+		for name, endpoint := range goal.networks {
+			err = goal.DockerClient.NetworkConnect(context.Background(), name, container.ID, endpoint)
+			if err != nil {
+				goal.SetCurrentStatus("error: " + err.Error())
+				return
+			}
+		}
+
 		// err = goal.DockerClient.StartContainer(container.ID, nil)
 		err = goal.DockerClient.ContainerStart(context.Background(), container.ID, types.ContainerStartOptions{})
 
@@ -422,9 +966,11 @@ func ParseRepositoryTag(repos string) (string, string) {
 	return repos, ""
 }
 
-func NewGoal(application *Application, goalName string, applicationName string, configs map[string]*GoalConfiguration, dockerClient *client.Client) *Goal {
+func NewGoal(application *Application, goalName string, applicationName string, applicationConfig *ApplicationConfiguration, dockerClient *client.Client) *Goal {
+
+	config := applicationConfig.Goals[goalName]
 
-	config := configs[goalName]
+	spec := NewContainerSpec(applicationName, goalName, applicationConfig.Goals, applicationConfig.Volumes)
 
 	emitter := emission.NewEmitter()
 	emitter.SetMaxListeners(MaxListeners)
@@ -437,266 +983,359 @@ func NewGoal(application *Application, goalName string, applicationName string,
 		CurrentStatus:        "not_running",
 		RunAfterStatuses:     map[string]string{},
 		LinksStatuses:        map[string]string{},
+		VolumesFromStatuses:  map[string]string{},
+		HealthyLinks:         config.HealthyLinks(),
 		AuthConfig:           config.AuthConfig,
 		UpstreamGoalStatuses: map[string]string{},
 		SmartRestart:         config.SmartRestart,
-		containerConfig: &container.Config{
-			Image:        config.Image,
-			Cmd:          config.Command,
-			ExposedPorts: map[nat.Port]struct{}{},
-			Env:          []string{},
-			Labels:       config.Labels,
-			WorkingDir:   config.WorkingDir,
-			Entrypoint:   config.Entrypoint,
-			User:         config.User,
-			Hostname:     config.Hostname,
-			Domainname:   config.Domainname,
-			MacAddress:   config.MacAddress,
-			OpenStdin:    config.StdinOpen,
-			Tty:          config.Tty,
-			// TODO this has changed!
-			// VolumeDriver: config.VolumeDriver,
-			AttachStdin:  config.AttachStdin,
-			AttachStdout: config.AttachStdout,
-			AttachStderr: config.AttachStderr,
-		},
-		hostConfig: &container.HostConfig{
-			ExtraHosts:     config.ExtraHosts,
-			PortBindings:   nat.PortMap{},
-			Binds:          []string{},
-			CapAdd:         config.CapAdd,
-			CapDrop:        config.CapDrop,
-			DNSSearch:      config.DNSSearch,
-			SecurityOpt:    config.SecurityOpt,
-			Privileged:     config.Privileged,
-			ReadonlyRootfs: config.ReadOnly,
-			Resources: container.Resources{
-				Devices:    []container.DeviceMapping{},
-				Memory:     config.MemLimit,
-				MemorySwap: config.MemSwapLimit,
-				CPUShares:  config.CpuShares,
-				CpusetCpus: config.CpuSet,
-				CpusetMems: config.CpuSet,
-			},
-		},
-		networkingConfig: &network.NetworkingConfig{},
-		Emitter:          emitter,
-		tracker:          stats.NewTracker(120 * time.Second),
-	}
-
-	if config.Restart != "" {
-		// goal.hostConfig.RestartPolicy = docker.RestartPolicy{Name: config.Restart}
-		goal.hostConfig.RestartPolicy.Name = config.Restart
-	}
-
-	for _, deviceString := range config.Devices {
-		parts := strings.Split(deviceString, ":")
-		perm := "mrw"
-		hostDevice := parts[0]
-		containerDevice := parts[0]
-		if len(parts) == 3 {
-			perm = parts[2]
-			containerDevice = parts[1]
-		} else if len(parts) == 2 {
-			if len(parts[1]) > 3 {
-				containerDevice = parts[1]
-			} else {
-				containerDevice = parts[0]
-				perm = parts[1]
-			}
-		}
+		configuration:        config,
+		removeVolumes:        applicationConfig.removesVolumes(),
+		pullPolicy:           config.PullPolicy,
+		containerName:        spec.Name,
+		containerConfig:      spec.Config,
+		hostConfig:           spec.HostConfig,
+		networkingConfig:     spec.NetworkingConfig,
+		networks:             spec.Networks,
+		Emitter:              emitter,
+		tracker:              stats.NewTracker(120 * time.Second),
+	}
 
-		goal.hostConfig.Devices = append(goal.hostConfig.Devices, container.DeviceMapping{
-			PathOnHost:        hostDevice,
-			PathInContainer:   containerDevice,
-			CgroupPermissions: perm,
-		})
+	if goal.pullPolicy == "" {
+		goal.pullPolicy = DefaultPullPolicy
 	}
 
-	if len(config.Dns) != 0 {
-		goal.hostConfig.DNS = config.Dns
+	for _, name := range config.RunAfter {
+		goal.RunAfterStatuses[name] = "unknown"
 	}
 
-	if config.Net != "" {
-		goal.hostConfig.NetworkMode = container.NetworkMode(config.Net)
+	for _, lc := range config.LinkedContainers() {
+		goal.LinksStatuses[lc.Name] = "unknown"
 	}
 
-	if config.LogDriver != "" {
-		goal.hostConfig.LogConfig = container.LogConfig{
-			Type:   config.LogDriver,
-			Config: config.LogConfig,
-		}
+	for _, name := range config.volumesFromGoals() {
+		goal.VolumesFromStatuses[name] = "unknown"
 	}
 
-	for k, v := range config.Environment {
-		goal.containerConfig.Env = append(goal.containerConfig.Env, k+"="+v)
+	goal.broadcastStatus()
+
+	return goal
+}
+
+// AdoptContainer looks for a container of the goal left behind by a previous
+// apparatchik process and takes over tracking it instead of creating a new
+// one. Returns false when there is no container that could be adopted.
+func (goal *Goal) AdoptContainer() (bool, error) {
+	existing, err := goal.findContainerIdByName(goal.containerName)
+	if err != nil {
+		return false, err
 	}
 
-	for _, bind := range config.Volumes {
-		parts := strings.Split(bind, ":")
-		if len(parts) == 1 {
-			goal.hostConfig.Binds = append(goal.hostConfig.Binds, replaceRelativePath(parts[0]+":"+parts[0]))
-		} else if len(parts) == 2 {
-			if parts[1] == "rw" || parts[1] == "ro" {
-				goal.hostConfig.Binds = append(goal.hostConfig.Binds, replaceRelativePath(parts[0]+":"+parts[0]+":"+parts[1]))
-			} else {
-				goal.hostConfig.Binds = append(goal.hostConfig.Binds, replaceRelativePath(bind))
+	if existing == nil {
+		return false, nil
+	}
+
+	container, err := goal.DockerClient.ContainerInspect(context.Background(), existing.ID)
+	if err != nil {
+		return false, err
+	}
+
+	goal.Lock()
+	defer goal.Unlock()
+
+	containerID := container.ID
+
+	switch {
+	case container.State.Running:
+		goal.ContainerId = &containerID
+		goal.ImageExists = true
+		goal.ShouldRun = true
+		goal.CurrentStatus = "running"
+		if container.State.Paused {
+			goal.CurrentStatus = "paused"
+		}
+		goal.startedAt = parseDockerTime(container.State.StartedAt)
+		if container.State.Health != nil {
+			goal.health = container.State.Health.Status
+			if !container.State.Paused && !goal.configuration.Healthcheck.hasProbe() && (goal.health == "healthy" || goal.health == "unhealthy") {
+				goal.CurrentStatus = goal.health
 			}
+		}
+		go goal.startTailingLog(containerID, goal.startedAt)
+		go goal.startTrackingContainer()
+		go goal.startHealthChecking(containerID)
+		return true, nil
+	case container.State.Status == "exited":
+		goal.ContainerId = &containerID
+		goal.ImageExists = true
+		goal.recordExitState(container.State)
+		go goal.archiveRun(containerID, container.Config != nil && container.Config.Tty, goal.startedAt)
+		if container.State.ExitCode == 0 {
+			goal.CurrentStatus = "terminated"
 		} else {
-			goal.hostConfig.Binds = append(goal.hostConfig.Binds, replaceRelativePath(bind))
+			goal.CurrentStatus = "failed"
 		}
+		return true, nil
+	}
 
+	return false, nil
+}
+
+// recordExitState remembers how the container of the goal ran and exited.
+func (goal *Goal) recordExitState(state *types.ContainerState) {
+	exitCode := state.ExitCode
+	goal.ExitCode = &exitCode
+	goal.oomKilled = state.OOMKilled
+	goal.exitError = state.Error
+	goal.startedAt = parseDockerTime(state.StartedAt)
+	goal.finishedAt = parseDockerTime(state.FinishedAt)
+}
+
+// parseDockerTime parses a time reported by Docker. Times that are not set
+// are reported as the zero time.
+func parseDockerTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil || t.Year() <= 1 {
+		return time.Time{}
 	}
+	return t
+}
 
-	for _, name := range config.RunAfter {
-		goal.RunAfterStatuses[name] = "unknown"
+// timePointer returns nil for the zero time.
+func timePointer(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
 	}
+	return &t
+}
 
-	for _, link := range config.Links {
-		parts := strings.Split(link, ":")
-		name := parts[0]
-		alias := name
-		if len(parts) > 1 {
-			alias = parts[1]
-		}
-		goal.LinksStatuses[name] = "unknown"
+func (g *Goal) broadcastStatus() {
+	status := g.status()
+	g.Emitter.EmitAsync("update", status)
+	g.application.publishEvent(Event{Type: EventGoalUpdate, Goal: g.Name, Data: status})
+}
+
+func (goal *Goal) FetchImage() {
+
+	goal.Lock()
+	defer goal.Unlock()
 
-		goal.hostConfig.Links = append(goal.hostConfig.Links, containerName(applicationName, name, configs[name].ContainerName)+":"+alias)
+	goal.cancelPullRetry()
+	goal.pullAttempt = 0
+	goal.lastPullError = ""
 
+	go goal.fetchImage(goal.containerConfig.Image, goal.pullPolicy)
+}
+
+func (goal *Goal) fetchImage(image, pullPolicy string) {
+	imageID, err := goal.pullImage(image, pullPolicy)
+	if err != nil {
+		log.Error(err)
+		goal.pullFailed(image, pullPolicy, err.Error())
+		return
 	}
 
-	for _, link := range config.ExternalLinks {
-		parts := strings.Split(link, ":")
-		name := parts[0]
-		alias := name
-		if len(parts) > 1 {
-			alias = parts[1]
-		}
+	goal.pullSucceeded(imageID)
+	goal.FetchImageFinished()
+}
 
-		goal.hostConfig.Links = append(goal.hostConfig.Links, name+":"+alias)
+// pullImage makes sure that the image is present, pulling it when the pull
+// policy requires so, and returns the ID of the image.
+func (goal *Goal) pullImage(image, pullPolicy string) (string, error) {
+	existing, _, err := goal.DockerClient.ImageInspectWithRaw(context.Background(), image)
 
+	if err != nil && !client.IsErrImageNotFound(err) {
+		return "", err
 	}
 
-	for _, port := range config.Ports {
-		protoParts := strings.Split(port, "/")
+	exists := err == nil
 
-		proto := "tcp"
+	if exists && pullPolicy != PullAlways {
+		return existing.ID, nil
+	}
 
-		if len(protoParts) == 2 {
-			proto = protoParts[1]
-		}
+	if pullPolicy == PullNever {
+		return "", fmt.Errorf("image %s is not present and pull policy is %s", image, PullNever)
+	}
 
-		parts := strings.Split(protoParts[0], ":")
+	r, err := goal.DockerClient.ImagePull(context.Background(), image, types.ImagePullOptions{
+		RegistryAuth: goal.AuthConfig.toDockerAuthConfig(),
+	})
 
-		hostPort := ""
+	if err != nil {
+		return "", err
+	}
 
-		containerPort := parts[0]
+	err = decodePullProgress(r, goal.setPullProgress)
+	goal.clearPullProgress()
+	if err != nil {
+		r.Close()
+		return "", err
+	}
 
-		if len(parts) == 2 {
-			hostPort = parts[0]
-			containerPort = parts[1]
-			portBinding := nat.PortBinding{HostPort: hostPort}
-			goal.hostConfig.PortBindings[nat.Port(containerPort+"/"+proto)] = []nat.PortBinding{portBinding}
-		} else {
-			goal.hostConfig.PortBindings[nat.Port(containerPort+"/"+proto)] = []nat.PortBinding{}
-		}
+	err = r.Close()
 
+	if err != nil {
+		return "", err
 	}
 
-	for _, port := range config.Expose {
-		protoParts := strings.Split(port, "/")
+	pulled, _, err := goal.DockerClient.ImageInspectWithRaw(context.Background(), image)
+	if err != nil {
+		return "", err
+	}
 
-		proto := "tcp"
+	return pulled.ID, nil
+}
 
-		if len(protoParts) == 2 {
-			proto = protoParts[1]
-		}
+// pullFailed retries pulling the image after a backoff that grows with every
+// attempt. The goal is in the retrying_pull status until then. When there are
+// no retries left, the goal ends up in the error status.
+func (goal *Goal) pullFailed(image, pullPolicy, reason string) {
+	goal.Lock()
+	defer goal.Unlock()
 
-		goal.containerConfig.ExposedPorts[nat.Port(protoParts[0]+"/"+proto)] = struct{}{}
+	goal.lastPullError = reason
 
+	if goal.pullAttempt >= goal.configuration.pullRetries() {
+		goal.setCurrentStatus("error: " + reason)
+		goal.broadcastStatus()
+		return
 	}
 
-	goal.containerName = fmt.Sprintf("ap_%s_%s", applicationName, goalName)
-	if config.ContainerName != "" {
-		goal.containerName = config.ContainerName
-	}
+	backoff := goal.configuration.pullBackoff(goal.pullAttempt)
+	goal.pullAttempt++
 
-	goal.FetchImage()
+	go goal.AddLineToTail(fmt.Sprintf("Pulling image %s failed: %s, retrying in %s\n", image, reason, backoff))
 
+	goal.setCurrentStatus("retrying_pull")
 	goal.broadcastStatus()
 
-	return goal
+	goal.pullTimer = time.AfterFunc(backoff, func() {
+		goal.Lock()
+		defer goal.Unlock()
+
+		if goal.CurrentStatus != "retrying_pull" {
+			return
+		}
+
+		goal.pullTimer = nil
+		goal.setCurrentStatus("fetching_image")
+		goal.broadcastStatus()
+
+		go goal.fetchImage(image, pullPolicy)
+	})
 }
 
-func (g *Goal) broadcastStatus() {
-	g.Emitter.EmitAsync("update", g.status())
+func (goal *Goal) pullSucceeded(imageID string) {
+	goal.Lock()
+	defer goal.Unlock()
+	goal.imageID = imageID
+	goal.pullAttempt = 0
+	goal.lastPullError = ""
 }
 
-func replaceRelativePath(pth string) string {
-	if strings.HasPrefix(pth, "./") {
-		wd, _ := os.Getwd()
-		return path.Join(wd, pth[2:])
+func (goal *Goal) cancelPullRetry() {
+	if goal.pullTimer != nil {
+		goal.pullTimer.Stop()
+		goal.pullTimer = nil
 	}
-	return pth
 }
 
-func (goal *Goal) FetchImage() {
-
+// RetryPull pulls the image of a goal that failed to pull it again, without
+// waiting for the next scheduled retry.
+func (goal *Goal) RetryPull() error {
 	goal.Lock()
 	defer goal.Unlock()
 
-	go func() {
+	if !goal.pullFailedStatus() {
+		return ErrGoalNotInError
+	}
 
-		// _, _, err := goal.DockerClient.ImageInspectWithRaw(context.Background(), goal.containerConfig.Image)
-		//
-		// if err != nil && !client.IsErrImageNotFound(err) {
-		// 	log.Error(err)
-		// 	goal.FetchImageFailed(err.Error())
-		// 	return
-		// }
-		//
-		// if err == nil {
-		// 	goal.FetchImageFinished()
-		// 	return
-		// }
-
-		r, err := goal.DockerClient.ImagePull(context.Background(), goal.containerConfig.Image, types.ImagePullOptions{
-			RegistryAuth: goal.AuthConfig.toDockerAuthConfig(),
-		})
+	goal.retryPull()
 
-		if err != nil {
-			goal.FetchImageFailed(err.Error())
-			return
-		}
+	return nil
+}
 
-		_, err = io.Copy(ioutil.Discard, r)
-		if err != nil {
-			goal.FetchImageFailed(err.Error())
-			return
-		}
+func (goal *Goal) retryPull() {
+	goal.cancelPullRetry()
+	goal.pullAttempt = 0
+	goal.lastPullError = ""
+	goal.setCurrentStatus("fetching_image")
+	goal.broadcastStatus()
 
-		err = r.Close()
+	go goal.fetchImage(goal.containerConfig.Image, goal.pullPolicy)
+}
 
-		if err != nil {
-			goal.FetchImageFailed(err.Error())
-			return
-		}
+// pullFailedStatus returns true while the goal is waiting to retry pulling
+// its image or gave up pulling it. Errors of starting or stopping the
+// container are not pull failures.
+func (goal *Goal) pullFailedStatus() bool {
+	if goal.CurrentStatus == "retrying_pull" {
+		return true
+	}
+	return goal.lastPullError != "" && goal.CurrentStatus == "error: "+goal.lastPullError
+}
 
-		goal.FetchImageFinished()
+const pullProgressInterval = 500 * time.Millisecond
 
-	}()
+// setPullProgress records the progress of pulling the image. Listeners are
+// notified at most once per pullProgressInterval.
+func (goal *Goal) setPullProgress(progress PullProgress) {
+	goal.Lock()
+	defer goal.Unlock()
+
+	goal.pullProgress = &progress
 
+	if time.Since(goal.pullProgressEmitted) < pullProgressInterval {
+		return
+	}
+
+	goal.pullProgressEmitted = time.Now()
+	goal.emitPullProgress()
 }
 
-func (goal *Goal) SiblingStatusUpdate(goalName, status string) {
+func (goal *Goal) clearPullProgress() {
 	goal.Lock()
 	defer goal.Unlock()
+
+	goal.pullProgress = nil
+	goal.pullProgressEmitted = time.Time{}
+	goal.emitPullProgress()
+}
+
+func (goal *Goal) emitPullProgress() {
+	goal.EmitAsync("pull_progress", goal.pullProgress)
+	if goal.pullProgress != nil {
+		goal.application.publishEvent(Event{Type: EventGoalPullProgress, Goal: goal.Name, Data: *goal.pullProgress})
+	}
+	goal.broadcastStatus()
+	go goal.application.emitUpdate()
+}
+
+func (goal *Goal) recordSiblingStatus(goalName, status string) {
 	if _, ok := goal.RunAfterStatuses[goalName]; ok {
 		goal.RunAfterStatuses[goalName] = status
 	}
 	if _, ok := goal.LinksStatuses[goalName]; ok {
 		goal.LinksStatuses[goalName] = status
 	}
+	if _, ok := goal.VolumesFromStatuses[goalName]; ok {
+		goal.VolumesFromStatuses[goalName] = status
+	}
+}
+
+// SeedSiblingStatus records the status of a sibling goal without starting or
+// stopping the container. Used when restoring goals so that adopted
+// containers are not stopped because of unknown dependency statuses.
+func (goal *Goal) SeedSiblingStatus(goalName, status string) {
+	goal.Lock()
+	defer goal.Unlock()
+	goal.recordSiblingStatus(goalName, status)
+}
+
+func (goal *Goal) SiblingStatusUpdate(goalName, status string) {
+	goal.Lock()
+	defer goal.Unlock()
+	goal.recordSiblingStatus(goalName, status)
 
 	if goal.canRun() {
 		goal.startContainer()
@@ -706,11 +1345,28 @@ func (goal *Goal) SiblingStatusUpdate(goalName, status string) {
 }
 
 func (goal *Goal) status() GoalStatus {
+	containerID := ""
+	if goal.ContainerId != nil {
+		containerID = *goal.ContainerId
+	}
 
 	return GoalStatus{
-		Name:     goal.Name,
-		Status:   goal.CurrentStatus,
-		ExitCode: goal.ExitCode,
+		Name:          goal.Name,
+		Status:        goal.CurrentStatus,
+		ExitCode:      goal.ExitCode,
+		NextRetry:     goal.nextRetry,
+		Health:        goal.health,
+		PullPolicy:    goal.pullPolicy,
+		ImageID:       goal.imageID,
+		PullProgress:  goal.pullProgress,
+		PullAttempt:   goal.pullAttempt,
+		LastPullError: goal.lastPullError,
+		OOMKilled:     goal.oomKilled,
+		Error:         goal.exitError,
+		StartedAt:     timePointer(goal.startedAt),
+		FinishedAt:    timePointer(goal.finishedAt),
+		RestartCount:  goal.restartCount,
+		ContainerID:   containerID,
 	}
 }
 
@@ -725,6 +1381,11 @@ func (goal *Goal) Start() {
 	defer goal.Unlock()
 	goal.ShouldRun = true
 
+	// a goal backing off is started by the scheduled restart
+	if IsRunningStatus(goal.CurrentStatus) || goal.CurrentStatus == "paused" || goal.CurrentStatus == "crash_loop_backoff" {
+		return
+	}
+
 	if goal.canRun() {
 		goal.startContainer()
 	} else {
@@ -739,7 +1400,12 @@ func (goal *Goal) Start() {
 			}
 		}
 		for name, status := range goal.LinksStatuses {
-			if status != "running" {
+			if !IsRunningStatus(status) {
+				go goal.application.RequestGoalStart(name)
+			}
+		}
+		for name, status := range goal.VolumesFromStatuses {
+			if !volumesFromReady(status) {
 				go goal.application.RequestGoalStart(name)
 			}
 		}
@@ -0,0 +1,253 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoalStatusReportsExitState(t *testing.T) {
+	containerID := "4fa6e0f0c678"
+	goal := &Goal{Name: "db", CurrentStatus: "failed", ContainerId: &containerID, restartCount: 2}
+	goal.recordExitState(&types.ContainerState{
+		ExitCode:   137,
+		OOMKilled:  true,
+		Error:      "",
+		StartedAt:  "2017-03-01T10:00:00.5Z",
+		FinishedAt: "2017-03-01T10:05:00Z",
+	})
+
+	status := goal.status()
+	require.Equal(t, 137, *status.ExitCode)
+	require.True(t, status.OOMKilled)
+	require.Equal(t, time.Date(2017, 3, 1, 10, 0, 0, 500000000, time.UTC), *status.StartedAt)
+	require.Equal(t, time.Date(2017, 3, 1, 10, 5, 0, 0, time.UTC), *status.FinishedAt)
+	require.Equal(t, 2, status.RestartCount)
+	require.Equal(t, containerID, status.ContainerID)
+}
+
+func TestGoalStatusOmitsTimesNotReportedByDocker(t *testing.T) {
+	goal := &Goal{Name: "db", CurrentStatus: "failed"}
+	goal.recordExitState(&types.ContainerState{ExitCode: 1, StartedAt: "0001-01-01T00:00:00Z", FinishedAt: ""})
+
+	status := goal.status()
+	require.Nil(t, status.StartedAt)
+	require.Nil(t, status.FinishedAt)
+	require.Equal(t, "", status.ContainerID)
+}
+
+func TestGoalKeepsBoundedTransitionLog(t *testing.T) {
+	goal := &Goal{Name: "db"}
+	for i := 0; i < MaxTransitionLogEntries+5; i++ {
+		goal.recordTransition("running")
+	}
+	goal.recordTransition("failed")
+
+	entries := goal.TransitionLog()
+	require.Len(t, entries, MaxTransitionLogEntries)
+	require.Equal(t, "failed", entries[len(entries)-1].Status)
+}
+
+func TestGoalContinuesRestoredTransitionLog(t *testing.T) {
+	goal := &Goal{Name: "db"}
+	goal.recordTransition("running")
+	goal.restoreTransitionLog([]TransitionLogEntry{{Time: time.Unix(0, 0), Status: "starting"}})
+
+	entries := goal.TransitionLog()
+	require.Len(t, entries, 2)
+	require.Equal(t, "starting", entries[0].Status)
+	require.Equal(t, "running", entries[1].Status)
+}
+
+func TestStatsEntryNormalizesCPUByOnlineCPUs(t *testing.T) {
+	st := types.StatsJSON{}
+	st.Read = time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+	st.CPUStats.CPUUsage.TotalUsage = 3000
+	st.CPUStats.SystemUsage = 20000
+	st.CPUStats.OnlineCPUs = 4
+	st.PreCPUStats.CPUUsage.TotalUsage = 1000
+	st.PreCPUStats.SystemUsage = 10000
+	st.MemoryStats = types.MemoryStats{Usage: 300, Limit: 1000, Stats: map[string]uint64{"cache": 100}}
+	st.Networks = map[string]types.NetworkStats{
+		"eth0": {RxBytes: 10, TxBytes: 20},
+		"eth1": {RxBytes: 1, TxBytes: 2},
+	}
+	st.BlkioStats.IoServiceBytesRecursive = []types.BlkioStatEntry{
+		{Op: "Read", Value: 5},
+		{Op: "Write", Value: 7},
+		{Op: "Total", Value: 12},
+	}
+	st.PidsStats.Current = 3
+
+	entry := statsEntry(st)
+	require.Equal(t, st.Read, entry.Time)
+	require.Equal(t, uint64(2000), entry.CPU)
+	require.InDelta(t, 80.0, entry.CPUPercent, 0.001)
+	require.Equal(t, uint64(300), entry.Memory)
+	require.Equal(t, uint64(1000), entry.MemoryLimit)
+	require.Equal(t, uint64(100), entry.MemoryCache)
+	require.Equal(t, uint64(11), entry.NetworkRx)
+	require.Equal(t, uint64(22), entry.NetworkTx)
+	require.Equal(t, uint64(5), entry.BlockRead)
+	require.Equal(t, uint64(7), entry.BlockWrite)
+	require.Equal(t, uint64(3), entry.Pids)
+}
+
+func TestStatsEntryCountsPerCPUUsageWithoutOnlineCPUs(t *testing.T) {
+	st := types.StatsJSON{}
+	st.CPUStats.CPUUsage.TotalUsage = 1000
+	st.CPUStats.CPUUsage.PercpuUsage = []uint64{500, 500}
+	st.CPUStats.SystemUsage = 10000
+
+	require.InDelta(t, 20.0, statsEntry(st).CPUPercent, 0.001)
+}
+
+func TestStartKeepsBackoffOfCrashingGoal(t *testing.T) {
+	nextRetry := time.Now().Add(time.Minute)
+	goal := &Goal{Name: "web", CurrentStatus: "crash_loop_backoff", restarts: 3, nextRetry: &nextRetry}
+
+	goal.Start()
+
+	require.True(t, goal.ShouldRun)
+	require.Equal(t, 3, goal.restarts)
+	require.Equal(t, "crash_loop_backoff", goal.Status().Status)
+	require.Equal(t, &nextRetry, goal.Status().NextRetry)
+}
+
+func TestCurrentStatsOfGoalWithoutStats(t *testing.T) {
+	goal := &Goal{Name: "web"}
+	_, err := goal.CurrentStats()
+	require.Equal(t, ErrGoalHasNoStats, err)
+
+	goal.currentStats = &types.StatsJSON{}
+	goal.currentStats.Read = time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+	current, err := goal.CurrentStats()
+	require.NoError(t, err)
+	require.Equal(t, goal.currentStats.Read, current.Read)
+}
+
+func TestRetryPullOnlyRetriesFailedPulls(t *testing.T) {
+	goal := &Goal{Name: "web", CurrentStatus: "error: could not start container"}
+	require.Equal(t, ErrGoalNotInError, goal.RetryPull())
+
+	goal.lastPullError = "no such image"
+	require.Equal(t, ErrGoalNotInError, goal.RetryPull())
+
+	goal.CurrentStatus = "error: no such image"
+	require.True(t, goal.pullFailedStatus())
+
+	goal.CurrentStatus = "retrying_pull"
+	require.True(t, goal.pullFailedStatus())
+}
+
+func newTestGoal(config *GoalConfiguration) *Goal {
+	applicationConfig := &ApplicationConfiguration{MainGoal: "web", Goals: map[string]*GoalConfiguration{"web": config}}
+	application := newApplication("app", applicationConfig, nil, nil)
+	goal := NewGoal(application, "web", "app", applicationConfig, nil)
+	application.Goals["web"] = goal
+	return goal
+}
+
+func exitedState(exitCode int, ranFor time.Duration) *types.ContainerState {
+	now := time.Now().UTC()
+	return &types.ContainerState{
+		ExitCode:   exitCode,
+		StartedAt:  now.Add(-ranFor).Format(time.RFC3339Nano),
+		FinishedAt: now.Format(time.RFC3339Nano),
+	}
+}
+
+func TestSmartRestartAfterRunningLongerThanResetWindow(t *testing.T) {
+	goal := newTestGoal(&GoalConfiguration{
+		Image:                 "alpine:3.2",
+		SmartRestart:          true,
+		RestartMaxAttempts:    2,
+		RestartResetWindow:    Duration(time.Minute),
+		RestartInitialBackoff: Duration(time.Hour),
+	})
+	goal.ShouldRun = true
+	goal.ImageExists = true
+	goal.CurrentStatus = "running"
+	goal.restarts = 2
+
+	goal.SetExitCode(exitedState(1, time.Hour))
+
+	goal.Lock()
+	defer goal.Unlock()
+	goal.cancelRestart()
+	require.Equal(t, "crash_loop_backoff", goal.CurrentStatus)
+	require.Equal(t, 1, goal.restarts)
+}
+
+func TestSmartRestartGivesUpAfterMaxAttempts(t *testing.T) {
+	goal := newTestGoal(&GoalConfiguration{
+		Image:              "alpine:3.2",
+		SmartRestart:       true,
+		RestartMaxAttempts: 2,
+		RestartResetWindow: Duration(time.Minute),
+	})
+	goal.ShouldRun = true
+	goal.ImageExists = true
+	goal.CurrentStatus = "running"
+	goal.restarts = 2
+
+	goal.SetExitCode(exitedState(1, time.Second))
+
+	require.Equal(t, "failed", goal.Status().Status)
+	require.Equal(t, 2, goal.restarts)
+}
+
+// fakeDockerWithContainer serves the container of the goal, other requests
+// are answered with 404.
+func fakeDockerWithContainer(t *testing.T, goal *Goal, state *types.ContainerState) *httptest.Server {
+	containerID := "4fa6e0f0c678"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/containers/json"):
+			json.NewEncoder(w).Encode([]types.Container{{ID: containerID, Names: []string{"/" + goal.containerName}}})
+		case strings.HasSuffix(r.URL.Path, "/containers/"+containerID+"/json"):
+			json.NewEncoder(w).Encode(types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{ID: containerID, State: state}})
+		case strings.HasSuffix(r.URL.Path, "/containers/"+containerID+"/pause"), strings.HasSuffix(r.URL.Path, "/containers/"+containerID+"/unpause"):
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	dockerClient, err := client.NewClient("tcp://"+server.Listener.Addr().String(), "1.24", nil, nil)
+	require.NoError(t, err)
+	goal.DockerClient = dockerClient
+
+	return server
+}
+
+func TestAdoptRunningContainer(t *testing.T) {
+	goal := newTestGoal(&GoalConfiguration{Image: "alpine:3.2"})
+	server := fakeDockerWithContainer(t, goal, &types.ContainerState{Status: "running", Running: true})
+	defer server.Close()
+
+	adopted, err := goal.AdoptContainer()
+	require.NoError(t, err)
+	require.True(t, adopted)
+	require.Equal(t, "running", goal.Status().Status)
+	require.True(t, goal.ShouldRun)
+}
+
+func TestAdoptPausedContainer(t *testing.T) {
+	goal := newTestGoal(&GoalConfiguration{Image: "alpine:3.2"})
+	server := fakeDockerWithContainer(t, goal, &types.ContainerState{Status: "paused", Running: true, Paused: true})
+	defer server.Close()
+
+	adopted, err := goal.AdoptContainer()
+	require.NoError(t, err)
+	require.True(t, adopted)
+	require.Equal(t, "paused", goal.Status().Status)
+	require.True(t, goal.ShouldRun)
+}
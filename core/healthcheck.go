@@ -0,0 +1,311 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+const (
+	DefaultHealthcheckInterval = 10 * time.Second
+	DefaultHealthcheckTimeout  = 5 * time.Second
+	DefaultHealthcheckRetries  = 3
+)
+
+// HTTPHealthcheck is healthy when a GET request to the port and path of the
+// container responds with a 2xx or 3xx status code.
+type HTTPHealthcheck struct {
+	Port int    `json:"port"`
+	Path string `json:"path,omitempty"`
+}
+
+// TCPHealthcheck is healthy when a TCP connection to the port of the
+// container can be established.
+type TCPHealthcheck struct {
+	Port int `json:"port"`
+}
+
+// HealthcheckConfiguration describes how Apparatchik probes readiness of a
+// running goal. Only one of HTTP, TCP and Exec should be set.
+//
+// Test, StartPeriod and Disable configure the native HEALTHCHECK of the
+// container run by Docker, which shares Interval, Timeout and Retries with
+// the Apparatchik probes.
+type HealthcheckConfiguration struct {
+	HTTP        *HTTPHealthcheck `json:"http,omitempty"`
+	TCP         *TCPHealthcheck  `json:"tcp,omitempty"`
+	Exec        []string         `json:"exec,omitempty"`
+	Test        []string         `json:"test,omitempty"`
+	Interval    Duration         `json:"interval,omitempty"`
+	Timeout     Duration         `json:"timeout,omitempty"`
+	StartPeriod Duration         `json:"start_period,omitempty"`
+	Retries     int              `json:"retries,omitempty"`
+	Disable     bool             `json:"disable,omitempty"`
+}
+
+func (h *HealthcheckConfiguration) hasProbe() bool {
+	return h != nil && (h.HTTP != nil || h.TCP != nil || len(h.Exec) > 0)
+}
+
+// reportsHealth returns true when the goal can become healthy, either
+// through a probe of Apparatchik or through the native health check.
+func (h *HealthcheckConfiguration) reportsHealth() bool {
+	return h.hasProbe() || (h != nil && !h.Disable && len(h.Test) > 0)
+}
+
+func (h *HealthcheckConfiguration) validate() error {
+	probes := 0
+	if h.HTTP != nil {
+		probes++
+		if h.HTTP.Port <= 0 {
+			return errors.New("http health check needs a port")
+		}
+	}
+	if h.TCP != nil {
+		probes++
+		if h.TCP.Port <= 0 {
+			return errors.New("tcp health check needs a port")
+		}
+	}
+	if len(h.Exec) > 0 {
+		probes++
+	}
+	if probes > 1 {
+		return errors.New("only one of http, tcp and exec health checks can be set")
+	}
+	if h.Disable && len(h.Test) > 0 {
+		return errors.New("health check can't be disabled and have a test")
+	}
+	if h.Interval < 0 || h.Timeout < 0 || h.StartPeriod < 0 || h.Retries < 0 {
+		return errors.New("health check has negative options")
+	}
+	return nil
+}
+
+// dockerHealthConfig returns the native health check of the container. The
+// HEALTHCHECK of the image is kept when no test is set and the goal is
+// probed by Apparatchik.
+func (h *HealthcheckConfiguration) dockerHealthConfig() *container.HealthConfig {
+	if h == nil {
+		return nil
+	}
+
+	if h.Disable {
+		return &container.HealthConfig{Test: []string{"NONE"}}
+	}
+
+	if len(h.Test) == 0 && h.hasProbe() {
+		return nil
+	}
+
+	test := h.Test
+	if len(test) > 0 && test[0] != "CMD" && test[0] != "CMD-SHELL" && test[0] != "NONE" {
+		test = append([]string{"CMD"}, test...)
+	}
+
+	return &container.HealthConfig{
+		Test:        test,
+		Interval:    time.Duration(h.Interval),
+		Timeout:     time.Duration(h.Timeout),
+		StartPeriod: time.Duration(h.StartPeriod),
+		Retries:     h.Retries,
+	}
+}
+
+func (h *HealthcheckConfiguration) interval() time.Duration {
+	if h.Interval == 0 {
+		return DefaultHealthcheckInterval
+	}
+	return time.Duration(h.Interval)
+}
+
+func (h *HealthcheckConfiguration) timeout() time.Duration {
+	if h.Timeout == 0 {
+		return DefaultHealthcheckTimeout
+	}
+	return time.Duration(h.Timeout)
+}
+
+func (h *HealthcheckConfiguration) retries() int {
+	if h.Retries == 0 {
+		return DefaultHealthcheckRetries
+	}
+	return h.Retries
+}
+
+// startHealthChecking periodically probes the container until it is replaced
+// or stops running. The goal becomes healthy after the first successful
+// probe and unhealthy after the configured number of consecutive failures.
+func (goal *Goal) startHealthChecking(containerID string) {
+	check := goal.configuration.Healthcheck
+	if !check.hasProbe() {
+		return
+	}
+
+	failures := 0
+
+	for {
+		time.Sleep(check.interval())
+
+		goal.Lock()
+		current := goal.ContainerId != nil && *goal.ContainerId == containerID
+		status := goal.CurrentStatus
+		goal.Unlock()
+
+		if !current || !(IsRunningStatus(status) || status == "paused") {
+			return
+		}
+
+		if status == "paused" {
+			continue
+		}
+
+		failures = goal.recordProbe(containerID, check, failures, goal.probe(containerID, check))
+	}
+}
+
+// recordProbe updates the status of the goal with the result of a probe and
+// returns the number of consecutive failed probes. Results for containers
+// that were replaced or stopped running meanwhile are ignored.
+func (goal *Goal) recordProbe(containerID string, check *HealthcheckConfiguration, failures int, err error) int {
+	goal.Lock()
+	defer goal.Unlock()
+
+	if goal.ContainerId == nil || *goal.ContainerId != containerID || !IsRunningStatus(goal.CurrentStatus) {
+		return failures
+	}
+
+	newStatus := goal.CurrentStatus
+	if err == nil {
+		failures = 0
+		newStatus = "healthy"
+	} else {
+		failures++
+		if failures >= check.retries() {
+			newStatus = "unhealthy"
+		}
+	}
+	if newStatus != goal.CurrentStatus {
+		if err != nil {
+			go goal.AddLineToTail(fmt.Sprintf("Health check failed: %s\n", err))
+		}
+		goal.setCurrentStatus(newStatus)
+		goal.broadcastStatus()
+	}
+
+	return failures
+}
+
+// handleHealthStatus records the health reported by the native health check
+// of the container. Unless the goal is probed by Apparatchik, the health also
+// becomes the status of the running goal.
+func (goal *Goal) handleHealthStatus(health string) {
+	goal.health = health
+
+	if !goal.configuration.Healthcheck.hasProbe() && IsRunningStatus(goal.CurrentStatus) && (health == "healthy" || health == "unhealthy") {
+		goal.setCurrentStatus(health)
+	}
+
+	goal.broadcastStatus()
+}
+
+func (goal *Goal) probe(containerID string, check *HealthcheckConfiguration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), check.timeout())
+	defer cancel()
+
+	if len(check.Exec) > 0 {
+		return goal.probeExec(ctx, containerID, check.Exec)
+	}
+
+	address, err := goal.containerAddress(ctx, containerID)
+	if err != nil {
+		return err
+	}
+
+	if check.TCP != nil {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", net.JoinHostPort(address, strconv.Itoa(check.TCP.Port)))
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	url := fmt.Sprintf("http://%s%s", net.JoinHostPort(address, strconv.Itoa(check.HTTP.Port)), check.HTTP.Path)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 400 {
+		return fmt.Errorf("GET %s responded with status %d", url, res.StatusCode)
+	}
+
+	return nil
+}
+
+func (goal *Goal) probeExec(ctx context.Context, containerID string, cmd []string) error {
+	exec, err := goal.DockerClient.ContainerExecCreate(ctx, containerID, types.ExecConfig{Cmd: cmd, Detach: true})
+	if err != nil {
+		return err
+	}
+
+	err = goal.DockerClient.ContainerExecStart(ctx, exec.ID, types.ExecStartCheck{Detach: true})
+	if err != nil {
+		return err
+	}
+
+	for {
+		inspect, err := goal.DockerClient.ContainerExecInspect(ctx, exec.ID)
+		if err != nil {
+			return err
+		}
+
+		if !inspect.Running {
+			if inspect.ExitCode != 0 {
+				return fmt.Errorf("%q exited with code %d", cmd, inspect.ExitCode)
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// containerAddress returns the IP address of the container. Containers
+// sharing the network of the host are reached on localhost.
+func (goal *Goal) containerAddress(ctx context.Context, containerID string) (string, error) {
+	container, err := goal.DockerClient.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return "", err
+	}
+
+	if container.NetworkSettings != nil {
+		if container.NetworkSettings.IPAddress != "" {
+			return container.NetworkSettings.IPAddress, nil
+		}
+		for _, endpoint := range container.NetworkSettings.Networks {
+			if endpoint != nil && endpoint.IPAddress != "" {
+				return endpoint.IPAddress, nil
+			}
+		}
+	}
+
+	return "localhost", nil
+}
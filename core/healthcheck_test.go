@@ -0,0 +1,153 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthcheckIsMappedToDockerHealthConfig(t *testing.T) {
+	var missing *HealthcheckConfiguration
+	require.Nil(t, missing.dockerHealthConfig())
+
+	check := &HealthcheckConfiguration{
+		Test:        []string{"pg_isready"},
+		Interval:    Duration(5 * time.Second),
+		StartPeriod: Duration(time.Minute),
+		Retries:     5,
+	}
+	require.Equal(t, &container.HealthConfig{
+		Test:        []string{"CMD", "pg_isready"},
+		Interval:    5 * time.Second,
+		StartPeriod: time.Minute,
+		Retries:     5,
+	}, check.dockerHealthConfig())
+
+	check = &HealthcheckConfiguration{Test: []string{"CMD-SHELL", "curl -f http://localhost/"}}
+	require.Equal(t, []string{"CMD-SHELL", "curl -f http://localhost/"}, check.dockerHealthConfig().Test)
+
+	check = &HealthcheckConfiguration{Disable: true}
+	require.Equal(t, &container.HealthConfig{Test: []string{"NONE"}}, check.dockerHealthConfig())
+
+	check = &HealthcheckConfiguration{TCP: &TCPHealthcheck{Port: 5432}}
+	require.Nil(t, check.dockerHealthConfig())
+}
+
+func TestHealthcheckProbeResultsChangeStatusOfGoal(t *testing.T) {
+	check := &HealthcheckConfiguration{TCP: &TCPHealthcheck{Port: 5432}, Retries: 2}
+	goal := newTestGoal(&GoalConfiguration{Image: "postgres:9.6", Healthcheck: check})
+	containerID := "4fa6e0f0c678"
+	goal.ContainerId = &containerID
+	goal.CurrentStatus = "running"
+	refused := errors.New("connection refused")
+
+	failures := goal.recordProbe(containerID, check, 0, refused)
+	require.Equal(t, 1, failures)
+	require.Equal(t, "running", goal.Status().Status)
+
+	failures = goal.recordProbe(containerID, check, failures, refused)
+	require.Equal(t, 2, failures)
+	require.Equal(t, "unhealthy", goal.Status().Status)
+
+	failures = goal.recordProbe(containerID, check, failures, nil)
+	require.Equal(t, 0, failures)
+	require.Equal(t, "healthy", goal.Status().Status)
+
+	failures = goal.recordProbe(containerID, check, failures, refused)
+	require.Equal(t, 1, failures)
+	require.Equal(t, "healthy", goal.Status().Status)
+
+	failures = goal.recordProbe("1c2d3e4f5a6b", check, failures, refused)
+	require.Equal(t, 1, failures)
+	require.Equal(t, "healthy", goal.Status().Status)
+}
+
+func TestHealthcheckProbesTCPAndHTTP(t *testing.T) {
+	goal := newTestGoal(&GoalConfiguration{Image: "nginx"})
+	docker := fakeDockerWithContainer(t, goal, &types.ContainerState{Status: "running", Running: true})
+	defer docker.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	require.NoError(t, goal.probe("4fa6e0f0c678", &HealthcheckConfiguration{TCP: &TCPHealthcheck{Port: port}}))
+	require.NoError(t, goal.probe("4fa6e0f0c678", &HealthcheckConfiguration{HTTP: &HTTPHealthcheck{Port: port, Path: "/health"}}))
+	require.Error(t, goal.probe("4fa6e0f0c678", &HealthcheckConfiguration{HTTP: &HTTPHealthcheck{Port: port, Path: "/broken"}}))
+
+	server.Close()
+	require.Error(t, goal.probe("4fa6e0f0c678", &HealthcheckConfiguration{TCP: &TCPHealthcheck{Port: port}}))
+}
+
+func TestHealthcheckProbesWithExec(t *testing.T) {
+	exitCode := 0
+	docker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/containers/4fa6e0f0c678/exec"):
+			json.NewEncoder(w).Encode(types.IDResponse{ID: "e1"})
+		case strings.HasSuffix(r.URL.Path, "/exec/e1/start"):
+		case strings.HasSuffix(r.URL.Path, "/exec/e1/json"):
+			json.NewEncoder(w).Encode(types.ContainerExecInspect{ExecID: "e1", ExitCode: exitCode})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer docker.Close()
+
+	goal := newTestGoal(&GoalConfiguration{Image: "postgres:9.6"})
+	dockerClient, err := client.NewClient("tcp://"+docker.Listener.Addr().String(), "1.24", nil, nil)
+	require.NoError(t, err)
+	goal.DockerClient = dockerClient
+
+	check := &HealthcheckConfiguration{Exec: []string{"pg_isready"}}
+	require.NoError(t, goal.probe("4fa6e0f0c678", check))
+
+	exitCode = 2
+	require.EqualError(t, goal.probe("4fa6e0f0c678", check), `["pg_isready"] exited with code 2`)
+}
+
+func TestHealthCheckingProbesRunningContainer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	check := &HealthcheckConfiguration{TCP: &TCPHealthcheck{Port: port}, Interval: Duration(10 * time.Millisecond), Retries: 2}
+	goal := newTestGoal(&GoalConfiguration{Image: "postgres:9.6", Healthcheck: check})
+	docker := fakeDockerWithContainer(t, goal, &types.ContainerState{Status: "running", Running: true})
+	defer docker.Close()
+	containerID := "4fa6e0f0c678"
+	goal.ContainerId = &containerID
+	goal.CurrentStatus = "running"
+
+	go goal.startHealthChecking(containerID)
+	defer goal.SetCurrentStatus("stopped")
+
+	require.True(t, waitForStatus(goal, "healthy"))
+	listener.Close()
+	require.True(t, waitForStatus(goal, "unhealthy"))
+}
+
+func waitForStatus(goal *Goal, status string) bool {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if goal.Status().Status == status {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return false
+}
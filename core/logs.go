@@ -0,0 +1,274 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	timetypes "github.com/docker/docker/api/types/time"
+	"github.com/docker/docker/client"
+	"github.com/netice9/apparatchik/core/logstore"
+)
+
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+var ErrGoalHasNoContainer = errors.New("Goal has no container")
+
+// LogStore keeps output of every run of the goals on disk. Output is kept
+// in memory only when it is nil.
+var LogStore *logstore.Store
+
+// LogLine is a single line of output of a goal.
+type LogLine struct {
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"`
+	Text   string    `json:"text"`
+}
+
+// Format returns the line as printed by `docker logs`, optionally prefixed
+// with its timestamp.
+func (l LogLine) Format(timestamps bool) string {
+	if timestamps && !l.Time.IsZero() {
+		return l.Time.Format(time.RFC3339Nano) + " " + l.Text
+	}
+	return l.Text
+}
+
+// LogOptions selects output of a goal like the options of `docker logs`.
+// Since and Until are RFC 3339 or Unix timestamps, or durations before now
+// such as "10m". Tail is the number of lines from the end of the output or
+// "all".
+type LogOptions struct {
+	Stdout bool
+	Stderr bool
+	Since  string
+	Until  string
+	Tail   string
+	Follow bool
+}
+
+// Validate checks that the times and the tail of the options can be parsed.
+func (o LogOptions) Validate() error {
+	if _, err := ParseLogTime(o.Since, time.Now()); err != nil {
+		return fmt.Errorf("Invalid since %q", o.Since)
+	}
+	if _, err := ParseLogTime(o.Until, time.Now()); err != nil {
+		return fmt.Errorf("Invalid until %q", o.Until)
+	}
+	if o.Tail != "" && o.Tail != "all" {
+		if n, err := strconv.Atoi(o.Tail); err != nil || n < 0 {
+			return fmt.Errorf("Invalid tail %q", o.Tail)
+		}
+	}
+	return nil
+}
+
+// ParseLogTime parses a time in any format accepted by Docker for the since
+// option. Empty value is the zero time.
+func ParseLogTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	timestamp, err := timetypes.GetTimestamp(value, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	seconds, nanoseconds, err := timetypes.ParseTimestamps(timestamp, 0)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, nanoseconds), nil
+}
+
+// LogStream reads output of a container line by line.
+type LogStream struct {
+	rc     io.ReadCloser
+	cancel context.CancelFunc
+	demux  *logDemuxer
+	until  time.Time
+}
+
+// openLogStream starts reading output of the container. Lines after
+// options.Until are not returned, following the output stops at that time.
+func openLogStream(ctx context.Context, dockerClient *client.Client, containerID string, tty bool, options LogOptions) (*LogStream, error) {
+	until, err := ParseLogTime(options.Until, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var cancel context.CancelFunc
+	if options.Follow && !until.IsZero() {
+		ctx, cancel = context.WithDeadline(ctx, until)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	rc, err := dockerClient.ContainerLogs(ctx, containerID, types.ContainerLogsOptions{
+		ShowStdout: options.Stdout,
+		ShowStderr: options.Stderr,
+		Since:      options.Since,
+		Tail:       options.Tail,
+		Follow:     options.Follow,
+		Timestamps: true,
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return &LogStream{
+		rc:     rc,
+		cancel: cancel,
+		demux:  newLogDemuxer(rc, tty),
+		until:  until,
+	}, nil
+}
+
+// Next returns the next line of the output. io.EOF is returned after the last
+// line.
+func (s *LogStream) Next() (LogLine, error) {
+	line, err := s.demux.next()
+	if err != nil {
+		if !s.until.IsZero() && !time.Now().Before(s.until) {
+			return LogLine{}, io.EOF
+		}
+		return LogLine{}, err
+	}
+	if !s.until.IsZero() && line.Time.After(s.until) {
+		return LogLine{}, io.EOF
+	}
+	return line, nil
+}
+
+func (s *LogStream) Close() error {
+	s.cancel()
+	return s.rc.Close()
+}
+
+// logDemuxer splits the output of a container into lines of stdout and
+// stderr. Unless the container has a TTY, Docker multiplexes both streams
+// into frames with an 8 byte header: the stream type, three zero bytes and
+// the big endian size of the payload.
+type logDemuxer struct {
+	r       *bufio.Reader
+	tty     bool
+	buffers map[string][]byte
+	pending []LogLine
+	err     error
+}
+
+func newLogDemuxer(r io.Reader, tty bool) *logDemuxer {
+	return &logDemuxer{
+		r:       bufio.NewReader(r),
+		tty:     tty,
+		buffers: map[string][]byte{},
+	}
+}
+
+func (d *logDemuxer) next() (LogLine, error) {
+	for len(d.pending) == 0 {
+		if d.err != nil {
+			return LogLine{}, d.err
+		}
+		d.readFrame()
+	}
+	line := d.pending[0]
+	d.pending = d.pending[1:]
+	return line, nil
+}
+
+func (d *logDemuxer) readFrame() {
+	if d.tty {
+		data, err := d.r.ReadBytes('\n')
+		d.append(StreamStdout, data)
+		if err != nil {
+			d.finish(err)
+		}
+		return
+	}
+
+	header := make([]byte, 8)
+	_, err := io.ReadFull(d.r, header)
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = errors.New("truncated log frame header")
+		}
+		d.finish(err)
+		return
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint32(header[4:]))
+	_, err = io.ReadFull(d.r, payload)
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = errors.New("truncated log frame")
+		}
+		d.finish(err)
+		return
+	}
+
+	switch header[0] {
+	case 1:
+		d.append(StreamStdout, payload)
+	case 2:
+		d.append(StreamStderr, payload)
+	case 3:
+		d.finish(fmt.Errorf("Docker: %s", strings.TrimSpace(string(payload))))
+	default:
+		d.finish(fmt.Errorf("unknown log stream %d", header[0]))
+	}
+}
+
+// append adds data to the partial line of the stream and queues all lines
+// that are complete.
+func (d *logDemuxer) append(stream string, data []byte) {
+	buffer := append(d.buffers[stream], data...)
+	for {
+		i := bytes.IndexByte(buffer, '\n')
+		if i < 0 {
+			break
+		}
+		d.pending = append(d.pending, parseLogLine(stream, string(buffer[:i+1])))
+		buffer = buffer[i+1:]
+	}
+	d.buffers[stream] = buffer
+}
+
+// finish queues partial lines left in the buffers and stops reading.
+func (d *logDemuxer) finish(err error) {
+	for _, stream := range []string{StreamStdout, StreamStderr} {
+		if len(d.buffers[stream]) > 0 {
+			d.pending = append(d.pending, parseLogLine(stream, string(d.buffers[stream])+"\n"))
+			d.buffers[stream] = nil
+		}
+	}
+	d.err = err
+}
+
+// parseLogLine splits the timestamp Docker prefixes every line with from
+// the text of the line.
+func parseLogLine(stream, raw string) LogLine {
+	line := LogLine{Stream: stream, Text: raw}
+	i := strings.IndexByte(raw, ' ')
+	if i < 0 {
+		return line
+	}
+	t, err := time.Parse(time.RFC3339Nano, raw[:i])
+	if err != nil {
+		return line
+	}
+	line.Time = t
+	line.Text = raw[i+1:]
+	return line
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func logFrame(stream byte, payload string) []byte {
+	header := []byte{stream, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+	return append(header, payload...)
+}
+
+func readLogLines(demux *logDemuxer) ([]LogLine, error) {
+	lines := []LogLine{}
+	for {
+		line, err := demux.next()
+		if err != nil {
+			return lines, err
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestLogDemuxerSeparatesStreams(t *testing.T) {
+	data := bytes.Buffer{}
+	data.Write(logFrame(1, "2017-03-01T10:00:00.000000001Z first\n2017-03-01T10:00:01Z sec"))
+	data.Write(logFrame(2, "2017-03-01T10:00:02Z error\n"))
+	data.Write(logFrame(1, "ond\n2017-03-01T10:00:03Z unfinished"))
+
+	lines, err := readLogLines(newLogDemuxer(&data, false))
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, []LogLine{
+		{Time: time.Date(2017, 3, 1, 10, 0, 0, 1, time.UTC), Stream: StreamStdout, Text: "first\n"},
+		{Time: time.Date(2017, 3, 1, 10, 0, 2, 0, time.UTC), Stream: StreamStderr, Text: "error\n"},
+		{Time: time.Date(2017, 3, 1, 10, 0, 1, 0, time.UTC), Stream: StreamStdout, Text: "second\n"},
+		{Time: time.Date(2017, 3, 1, 10, 0, 3, 0, time.UTC), Stream: StreamStdout, Text: "unfinished\n"},
+	}, lines)
+}
+
+func TestLogDemuxerReadsRawOutputOfTTY(t *testing.T) {
+	lines, err := readLogLines(newLogDemuxer(strings.NewReader("2017-03-01T10:00:00Z $ ls\nno timestamp\n"), true))
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, []LogLine{
+		{Time: time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC), Stream: StreamStdout, Text: "$ ls\n"},
+		{Stream: StreamStdout, Text: "no timestamp\n"},
+	}, lines)
+}
+
+func TestLogDemuxerReportsBrokenStreams(t *testing.T) {
+	frame := logFrame(1, "line\n")
+	_, err := readLogLines(newLogDemuxer(bytes.NewReader(frame[:len(frame)-2]), false))
+	require.EqualError(t, err, "truncated log frame")
+
+	_, err = readLogLines(newLogDemuxer(bytes.NewReader(logFrame(3, "no such container\n")), false))
+	require.EqualError(t, err, "Docker: no such container")
+}
+
+func TestLogLineFormat(t *testing.T) {
+	line := LogLine{Time: time.Date(2017, 3, 1, 10, 0, 0, 5, time.UTC), Stream: StreamStdout, Text: "hello\n"}
+	require.Equal(t, "hello\n", line.Format(false))
+	require.Equal(t, "2017-03-01T10:00:00.000000005Z hello\n", line.Format(true))
+}
+
+func TestLogOptionsValidate(t *testing.T) {
+	require.Nil(t, LogOptions{Since: "10m", Until: "2017-03-01T10:00:00Z", Tail: "100"}.Validate())
+	require.Nil(t, LogOptions{Since: "1488362400", Tail: "all"}.Validate())
+	require.EqualError(t, LogOptions{Since: "yesterday"}.Validate(), `Invalid since "yesterday"`)
+	require.EqualError(t, LogOptions{Tail: "-1"}.Validate(), `Invalid tail "-1"`)
+
+	now := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+	until, err := ParseLogTime("10m", now)
+	require.Nil(t, err)
+	require.True(t, until.Equal(now.Add(-10*time.Minute)))
+}
@@ -0,0 +1,221 @@
+package logstore
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultSearchContext = 2
+	DefaultSearchLimit   = 100
+)
+
+// errSearchDone stops reading output once more lines matched than the limit
+// of the query.
+var errSearchDone = errors.New("search done")
+
+// Query selects lines of the stored output containing Text, ignoring case.
+// Output of all applications and goals is searched unless Application or
+// Goal is set. Lines before Since don't match. Every match comes with
+// Context lines before and after it, at most Limit lines match.
+type Query struct {
+	Text        string
+	Application string
+	Goal        string
+	Since       time.Time
+	Context     int
+	Limit       int
+}
+
+// Match is a line of output matching a query together with the lines
+// around it.
+type Match struct {
+	Application string `json:"application"`
+	Goal        string `json:"goal"`
+	ContainerID string `json:"container_id"`
+	Line        Line   `json:"line"`
+	Before      []Line `json:"before"`
+	After       []Line `json:"after"`
+}
+
+// Search returns lines of stored output matching the query, ordered by
+// application, goal and run. truncated is set when more lines matched than
+// the limit of the query.
+func (s *Store) Search(query Query) (matches []Match, truncated bool, err error) {
+	if query.Limit <= 0 {
+		query.Limit = DefaultSearchLimit
+	}
+	if query.Context < 0 {
+		query.Context = 0
+	}
+
+	search := &search{query: query, text: strings.ToLower(query.Text), matches: []Match{}}
+
+	applications, err := subdirectories(s.dir, query.Application)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, application := range applications {
+		goals, err := subdirectories(filepath.Join(s.dir, application), query.Goal)
+		if err != nil {
+			return nil, false, err
+		}
+
+		for _, goal := range goals {
+			err = s.searchGoal(search, application, goal)
+			if err == errSearchDone {
+				return search.matches, search.truncated, nil
+			}
+			if err != nil {
+				return nil, false, err
+			}
+		}
+	}
+
+	return search.matches, search.truncated, nil
+}
+
+// subdirectories returns sorted names of directories in dir, or only the
+// named one when name is set.
+func subdirectories(dir string, name string) ([]string, error) {
+	if name != "" {
+		if validateName(name) != nil {
+			return []string{}, nil
+		}
+		if info, err := os.Stat(filepath.Join(dir, name)); err != nil || !info.IsDir() {
+			return []string{}, nil
+		}
+		return []string{name}, nil
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, file := range files {
+		if file.IsDir() {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *Store) searchGoal(search *search, application, goal string) error {
+	dir := filepath.Join(s.dir, application, goal)
+
+	s.Lock()
+	runs, err := loadIndex(dir)
+	s.Unlock()
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].StartedAt.Before(runs[j].StartedAt)
+	})
+
+	for _, run := range runs {
+		if run.FinishedAt != nil && run.FinishedAt.Before(search.query.Since) {
+			continue
+		}
+
+		search.startRun(application, goal, run.ContainerID)
+
+		s.Lock()
+		files := s.runFiles(dir, run.ContainerID)
+		s.Unlock()
+
+		for _, file := range files {
+			err = readLines(file, search.add)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// search collects matches of a query while reading output of a run line by
+// line.
+type search struct {
+	query     Query
+	text      string
+	matches   []Match
+	truncated bool
+
+	application string
+	goal        string
+	containerID string
+
+	// before are the last lines read, open are indexes of matches still
+	// waiting for lines after them.
+	before []Line
+	open   []int
+}
+
+func (s *search) startRun(application, goal, containerID string) {
+	s.application = application
+	s.goal = goal
+	s.containerID = containerID
+	s.before = nil
+	s.open = nil
+}
+
+func (s *search) add(line Line) error {
+	open := []int{}
+	for _, i := range s.open {
+		s.matches[i].After = append(s.matches[i].After, line)
+		if len(s.matches[i].After) < s.query.Context {
+			open = append(open, i)
+		}
+	}
+	s.open = open
+
+	full := len(s.matches) >= s.query.Limit
+
+	if s.isMatch(line) {
+		if full {
+			s.truncated = true
+		} else {
+			s.matches = append(s.matches, Match{
+				Application: s.application,
+				Goal:        s.goal,
+				ContainerID: s.containerID,
+				Line:        line,
+				Before:      append([]Line{}, s.before...),
+				After:       []Line{},
+			})
+			if s.query.Context > 0 {
+				s.open = append(s.open, len(s.matches)-1)
+			}
+		}
+	}
+
+	if s.truncated && len(s.open) == 0 {
+		return errSearchDone
+	}
+
+	s.before = append(s.before, line)
+	if len(s.before) > s.query.Context {
+		s.before = s.before[len(s.before)-s.query.Context:]
+	}
+
+	return nil
+}
+
+func (s *search) isMatch(line Line) bool {
+	if line.Time.Before(s.query.Since) {
+		return false
+	}
+	return strings.Contains(strings.ToLower(line.Text), s.text)
+}
@@ -0,0 +1,594 @@
+// Package logstore keeps output of container runs on disk so that it
+// survives restarts of goals and removal of applications.
+//
+// Output of every run is stored in the directory of its goal,
+// <dir>/<application>/<goal>/<container id>.log, as one JSON encoded line
+// per line of output. When the file grows over the maximum size it is
+// rotated to <container id>.log.1, .2 and so on. runs.json of the goal
+// indexes the runs with their start and end time and exit code.
+package logstore
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMaxFileSize = 10 * 1024 * 1024
+	DefaultMaxFiles    = 5
+	DefaultMaxGoalSize = 100 * 1024 * 1024
+	DefaultMaxAge      = 7 * 24 * time.Hour
+
+	indexFileName = "runs.json"
+)
+
+var ErrRunNotFound = errors.New("Run not found")
+
+// Line is a single line of output of a run.
+type Line struct {
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"`
+	Text   string    `json:"text"`
+}
+
+// Run describes a run of a container of a goal. FinishedAt and ExitCode are
+// not set while the container is running or when apparatchik could not see
+// it exit.
+type Run struct {
+	ContainerID string     `json:"container_id"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	ExitCode    *int       `json:"exit_code,omitempty"`
+	Size        int64      `json:"size"`
+}
+
+// Options limit how much output is kept. MaxFileSize and MaxFiles limit the
+// output of a single run, MaxGoalSize the output of all runs of a goal. Runs
+// that finished more than MaxAge ago are removed.
+type Options struct {
+	MaxFileSize int64
+	MaxFiles    int
+	MaxGoalSize int64
+	MaxAge      time.Duration
+}
+
+type Store struct {
+	sync.Mutex
+	dir     string
+	options Options
+}
+
+// New creates the store in the directory. Limits that are not set in the
+// options are replaced by the defaults.
+func New(dir string, options Options) (*Store, error) {
+	if options.MaxFileSize <= 0 {
+		options.MaxFileSize = DefaultMaxFileSize
+	}
+	if options.MaxFiles <= 0 {
+		options.MaxFiles = DefaultMaxFiles
+	}
+	if options.MaxGoalSize <= 0 {
+		options.MaxGoalSize = DefaultMaxGoalSize
+	}
+	if options.MaxAge <= 0 {
+		options.MaxAge = DefaultMaxAge
+	}
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{dir: dir, options: options}, nil
+}
+
+// validateName makes sure a name can't escape the directory of the store.
+func validateName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("Invalid name %q", name)
+	}
+	return nil
+}
+
+func (s *Store) goalDir(applicationName, goalName string) (string, error) {
+	for _, name := range []string{applicationName, goalName} {
+		if err := validateName(name); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(s.dir, applicationName, goalName), nil
+}
+
+func runFile(dir, containerID string) string {
+	return filepath.Join(dir, containerID+".log")
+}
+
+// runFiles returns files of the run from the oldest to the newest.
+func (s *Store) runFiles(dir, containerID string) []string {
+	files := []string{}
+	for i := s.options.MaxFiles - 1; i > 0; i-- {
+		file := fmt.Sprintf("%s.%d", runFile(dir, containerID), i)
+		if _, err := os.Stat(file); err == nil {
+			files = append(files, file)
+		}
+	}
+	return append(files, runFile(dir, containerID))
+}
+
+func (s *Store) runSize(dir, containerID string) int64 {
+	var size int64
+	for _, file := range s.runFiles(dir, containerID) {
+		if info, err := os.Stat(file); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+func loadIndex(dir string) ([]Run, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, indexFileName))
+	if os.IsNotExist(err) {
+		return []Run{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	runs := []Run{}
+	err = json.Unmarshal(data, &runs)
+	if err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+func saveIndex(dir string, runs []Run) error {
+	data, err := json.Marshal(runs)
+	if err != nil {
+		return err
+	}
+
+	tempFile := filepath.Join(dir, indexFileName+".tmp")
+	err = ioutil.WriteFile(tempFile, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tempFile, filepath.Join(dir, indexFileName))
+}
+
+func findRun(runs []Run, containerID string) int {
+	for i, run := range runs {
+		if run.ContainerID == containerID {
+			return i
+		}
+	}
+	return -1
+}
+
+// StartRun starts or resumes recording output of a container of the goal.
+// Lines that were already recorded before are skipped when recording of a
+// run is resumed.
+func (s *Store) StartRun(applicationName, goalName, containerID string, startedAt time.Time) (*RunWriter, error) {
+	if err := validateName(containerID); err != nil {
+		return nil, err
+	}
+
+	dir, err := s.goalDir(applicationName, goalName)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	runs, err := loadIndex(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	i := findRun(runs, containerID)
+	if i < 0 {
+		runs = append(runs, Run{ContainerID: containerID, StartedAt: startedAt})
+	} else if runs[i].FinishedAt != nil && startedAt.After(*runs[i].FinishedAt) {
+		// the container has been started again
+		runs[i].FinishedAt = nil
+		runs[i].ExitCode = nil
+	}
+
+	runs, err = s.prune(dir, runs, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	err = saveIndex(dir, runs)
+	if err != nil {
+		return nil, err
+	}
+
+	file := runFile(dir, containerID)
+	lastTime := lastLineTime(s.runFiles(dir, containerID))
+
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &RunWriter{
+		store:       s,
+		dir:         dir,
+		containerID: containerID,
+		file:        f,
+		size:        info.Size(),
+		resumeAfter: lastTime,
+	}, nil
+}
+
+// lastLineTime returns time of the last line stored in the files of a run,
+// oldest first. The newest file is empty right after it was rotated.
+func lastLineTime(files []string) time.Time {
+	last := time.Time{}
+	for i := len(files) - 1; i >= 0 && last.IsZero(); i-- {
+		readLines(files[i], func(line Line) error {
+			last = line.Time
+			return nil
+		})
+	}
+	return last
+}
+
+// FinishRun records when the container of the run started and exited and
+// its exit code. Runs that are not recorded are ignored.
+func (s *Store) FinishRun(applicationName, goalName, containerID string, startedAt, finishedAt time.Time, exitCode int) error {
+	dir, err := s.goalDir(applicationName, goalName)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	runs, err := loadIndex(dir)
+	if err != nil {
+		return err
+	}
+
+	i := findRun(runs, containerID)
+	if i < 0 {
+		return nil
+	}
+
+	if !startedAt.IsZero() {
+		runs[i].StartedAt = startedAt
+	}
+	runs[i].FinishedAt = &finishedAt
+	runs[i].ExitCode = &exitCode
+
+	runs, err = s.prune(dir, runs, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return saveIndex(dir, runs)
+}
+
+// Runs returns runs of the goal from the oldest to the newest.
+func (s *Store) Runs(applicationName, goalName string) ([]Run, error) {
+	dir, err := s.goalDir(applicationName, goalName)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	runs, err := loadIndex(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range runs {
+		runs[i].Size = s.runSize(dir, runs[i].ContainerID)
+	}
+
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].StartedAt.Before(runs[j].StartedAt)
+	})
+
+	return runs, nil
+}
+
+// ReadRun calls fn with every stored line of the run, oldest first. Reading
+// stops at the first error returned by fn.
+func (s *Store) ReadRun(applicationName, goalName, containerID string, fn func(Line) error) error {
+	if err := validateName(containerID); err != nil {
+		return ErrRunNotFound
+	}
+
+	dir, err := s.goalDir(applicationName, goalName)
+	if err != nil {
+		return ErrRunNotFound
+	}
+
+	s.Lock()
+	runs, err := loadIndex(dir)
+	files := s.runFiles(dir, containerID)
+	s.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if findRun(runs, containerID) < 0 {
+		return ErrRunNotFound
+	}
+
+	for _, file := range files {
+		err = readLines(file, fn)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readLines calls fn with every line of the file. Lines that can't be
+// decoded are skipped, a missing file has no lines.
+func readLines(file string, fn func(Line) error) error {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := Line{}
+		if json.Unmarshal(scanner.Bytes(), &line) != nil {
+			continue
+		}
+		err = fn(line)
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Prune removes runs of all goals that are over the age or size limits and
+// directories of goals and applications that have no runs left.
+func (s *Store) Prune() error {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+
+	applicationDirs, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, applicationDir := range applicationDirs {
+		if !applicationDir.IsDir() {
+			continue
+		}
+
+		dir := filepath.Join(s.dir, applicationDir.Name())
+		goalDirs, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, goalDir := range goalDirs {
+			if !goalDir.IsDir() {
+				continue
+			}
+
+			err = s.pruneGoal(filepath.Join(dir, goalDir.Name()), now)
+			if err != nil {
+				return err
+			}
+		}
+
+		// fails while the application has goals left
+		os.Remove(dir)
+	}
+
+	return nil
+}
+
+func (s *Store) pruneGoal(dir string, now time.Time) error {
+	runs, err := loadIndex(dir)
+	if err != nil {
+		return err
+	}
+
+	runs, err = s.prune(dir, runs, now)
+	if err != nil {
+		return err
+	}
+
+	if len(runs) == 0 {
+		return os.RemoveAll(dir)
+	}
+
+	return saveIndex(dir, runs)
+}
+
+// prune removes runs that finished more than MaxAge ago and then the oldest
+// finished runs until the output of the goal fits into MaxGoalSize. Runs that
+// didn't finish are only removed when nothing was written to them for
+// MaxAge.
+func (s *Store) prune(dir string, runs []Run, now time.Time) ([]Run, error) {
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].StartedAt.Before(runs[j].StartedAt)
+	})
+
+	kept := []Run{}
+	var size int64
+	for _, run := range runs {
+		if now.Sub(s.lastActivity(dir, run)) > s.options.MaxAge {
+			err := s.removeRun(dir, run.ContainerID)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		size += s.runSize(dir, run.ContainerID)
+		kept = append(kept, run)
+	}
+
+	runs = kept
+	kept = []Run{}
+	for _, run := range runs {
+		if size > s.options.MaxGoalSize && run.FinishedAt != nil {
+			size -= s.runSize(dir, run.ContainerID)
+			err := s.removeRun(dir, run.ContainerID)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		kept = append(kept, run)
+	}
+
+	return kept, nil
+}
+
+func (s *Store) lastActivity(dir string, run Run) time.Time {
+	if run.FinishedAt != nil {
+		return *run.FinishedAt
+	}
+	if info, err := os.Stat(runFile(dir, run.ContainerID)); err == nil {
+		return info.ModTime()
+	}
+	return run.StartedAt
+}
+
+func (s *Store) removeRun(dir, containerID string) error {
+	files, err := filepath.Glob(runFile(dir, containerID) + "*")
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		err = os.Remove(file)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunWriter records output of a single run.
+type RunWriter struct {
+	store       *Store
+	dir         string
+	containerID string
+	file        *os.File
+	size        int64
+
+	// resumeAfter is time of the last line recorded before the recording
+	// was resumed. Lines up to this time are skipped.
+	resumeAfter time.Time
+}
+
+// Write appends the line to the output of the run, rotating the file when
+// it grows over the maximum size.
+func (w *RunWriter) Write(line Line) error {
+	if !w.resumeAfter.IsZero() {
+		if !line.Time.After(w.resumeAfter) {
+			return nil
+		}
+		w.resumeAfter = time.Time{}
+	}
+
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if w.size > 0 && w.size+int64(len(data)) > w.store.options.MaxFileSize {
+		err = w.rotate()
+		if err != nil {
+			return err
+		}
+	}
+
+	n, err := w.file.Write(data)
+	w.size += int64(n)
+	return err
+}
+
+// rotate shifts the files of the run, dropping the oldest one, and starts a
+// new file.
+func (w *RunWriter) rotate() error {
+	w.store.Lock()
+	defer w.store.Unlock()
+
+	err := w.file.Close()
+	if err != nil {
+		return err
+	}
+
+	file := runFile(w.dir, w.containerID)
+	maxFiles := w.store.options.MaxFiles
+
+	err = os.Remove(fmt.Sprintf("%s.%d", file, maxFiles-1))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for i := maxFiles - 2; i > 0; i-- {
+		err = os.Rename(fmt.Sprintf("%s.%d", file, i), fmt.Sprintf("%s.%d", file, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if maxFiles > 1 {
+		err = os.Rename(file, file+".1")
+	} else {
+		err = os.Remove(file)
+	}
+	if err != nil {
+		return err
+	}
+
+	w.file, err = os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	w.size = 0
+	return nil
+}
+
+// Close stops recording. The run stays unfinished until FinishRun is
+// called.
+func (w *RunWriter) Close() error {
+	return w.file.Close()
+}
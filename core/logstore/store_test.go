@@ -0,0 +1,292 @@
+package logstore_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/netice9/apparatchik/core/logstore"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var startTime = time.Now().UTC().Truncate(time.Second).Add(-time.Hour)
+
+func lineAt(seconds int, text string) logstore.Line {
+	return logstore.Line{Time: startTime.Add(time.Duration(seconds) * time.Second), Stream: "stdout", Text: text + "\n"}
+}
+
+func readRun(store *logstore.Store, containerID string) []string {
+	texts := []string{}
+	err := store.ReadRun("app1", "goal1", containerID, func(line logstore.Line) error {
+		texts = append(texts, line.Text)
+		return nil
+	})
+	Expect(err).ToNot(HaveOccurred())
+	return texts
+}
+
+var _ = Describe("Store", func() {
+	var dir string
+	var store *logstore.Store
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "apparatchik-logs")
+		Expect(err).ToNot(HaveOccurred())
+		store, err = logstore.New(dir, logstore.Options{MaxFileSize: 200, MaxFiles: 3, MaxGoalSize: 1000})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Context("When a run is recorded and finished", func() {
+		BeforeEach(func() {
+			run, err := store.StartRun("app1", "goal1", "c1", startTime)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(run.Write(lineAt(1, "first"))).To(Succeed())
+			Expect(run.Write(lineAt(2, "second"))).To(Succeed())
+			Expect(run.Close()).To(Succeed())
+			Expect(store.FinishRun("app1", "goal1", "c1", startTime, startTime.Add(3*time.Second), 2)).To(Succeed())
+		})
+
+		It("Should index the run", func() {
+			runs, err := store.Runs("app1", "goal1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(runs).To(HaveLen(1))
+			Expect(runs[0].ContainerID).To(Equal("c1"))
+			Expect(runs[0].StartedAt).To(Equal(startTime))
+			Expect(*runs[0].FinishedAt).To(Equal(startTime.Add(3 * time.Second)))
+			Expect(*runs[0].ExitCode).To(Equal(2))
+			Expect(runs[0].Size).To(BeNumerically(">", 0))
+		})
+
+		It("Should return the output of the run", func() {
+			Expect(readRun(store, "c1")).To(Equal([]string{"first\n", "second\n"}))
+		})
+
+		Context("When recording of the run is resumed", func() {
+			BeforeEach(func() {
+				run, err := store.StartRun("app1", "goal1", "c1", startTime)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(run.Write(lineAt(1, "first"))).To(Succeed())
+				Expect(run.Write(lineAt(2, "second"))).To(Succeed())
+				Expect(run.Write(lineAt(3, "third"))).To(Succeed())
+				Expect(run.Close()).To(Succeed())
+			})
+
+			It("Should skip lines that were already recorded", func() {
+				Expect(readRun(store, "c1")).To(Equal([]string{"first\n", "second\n", "third\n"}))
+			})
+		})
+
+		Context("When the container is started again", func() {
+			BeforeEach(func() {
+				run, err := store.StartRun("app1", "goal1", "c1", startTime.Add(10*time.Second))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(run.Close()).To(Succeed())
+			})
+
+			It("Should forget the previous exit", func() {
+				runs, err := store.Runs("app1", "goal1")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(runs).To(HaveLen(1))
+				Expect(runs[0].FinishedAt).To(BeNil())
+				Expect(runs[0].ExitCode).To(BeNil())
+			})
+		})
+	})
+
+	Context("When the output of a run grows over the maximum file size", func() {
+		BeforeEach(func() {
+			run, err := store.StartRun("app1", "goal1", "c1", startTime)
+			Expect(err).ToNot(HaveOccurred())
+			for i := 0; i < 20; i++ {
+				Expect(run.Write(lineAt(i, fmt.Sprintf("line %d", i)))).To(Succeed())
+			}
+			Expect(run.Close()).To(Succeed())
+		})
+
+		It("Should keep only the newest files of the run", func() {
+			files, err := filepath.Glob(filepath.Join(dir, "app1", "goal1", "c1.log*"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(files).To(HaveLen(3))
+
+			texts := readRun(store, "c1")
+			Expect(texts[len(texts)-1]).To(Equal("line 19\n"))
+			Expect(texts[0]).ToNot(Equal("line 0\n"))
+		})
+	})
+
+	Context("When recording is resumed right after the newest file was rotated", func() {
+		BeforeEach(func() {
+			var err error
+			store, err = logstore.New(dir, logstore.Options{MaxFileSize: 200, MaxFiles: 20, MaxGoalSize: 100000})
+			Expect(err).ToNot(HaveOccurred())
+
+			run, err := store.StartRun("app1", "goal1", "c1", startTime)
+			Expect(err).ToNot(HaveOccurred())
+			for i := 0; i < 20; i++ {
+				Expect(run.Write(lineAt(i, fmt.Sprintf("line %d", i)))).To(Succeed())
+			}
+			Expect(run.Close()).To(Succeed())
+			Expect(os.Truncate(filepath.Join(dir, "app1", "goal1", "c1.log"), 0)).To(Succeed())
+
+			run, err = store.StartRun("app1", "goal1", "c1", startTime)
+			Expect(err).ToNot(HaveOccurred())
+			for i := 0; i < 21; i++ {
+				Expect(run.Write(lineAt(i, fmt.Sprintf("line %d", i)))).To(Succeed())
+			}
+			Expect(run.Close()).To(Succeed())
+		})
+
+		It("Should not record the replayed output again", func() {
+			expected := []string{}
+			for i := 0; i < 21; i++ {
+				expected = append(expected, fmt.Sprintf("line %d\n", i))
+			}
+			Expect(readRun(store, "c1")).To(Equal(expected))
+		})
+	})
+
+	Context("When output of the goal grows over the maximum goal size", func() {
+		BeforeEach(func() {
+			for i := 0; i < 10; i++ {
+				containerID := fmt.Sprintf("c%d", i)
+				run, err := store.StartRun("app1", "goal1", containerID, startTime.Add(time.Duration(i)*time.Minute))
+				Expect(err).ToNot(HaveOccurred())
+				for j := 0; j < 5; j++ {
+					Expect(run.Write(lineAt(i*60+j, "output"))).To(Succeed())
+				}
+				Expect(run.Close()).To(Succeed())
+				Expect(store.FinishRun("app1", "goal1", containerID, time.Time{}, time.Now(), 1)).To(Succeed())
+			}
+		})
+
+		It("Should remove the oldest runs", func() {
+			runs, err := store.Runs("app1", "goal1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(runs)).To(BeNumerically("<", 10))
+			Expect(runs[len(runs)-1].ContainerID).To(Equal("c9"))
+
+			var size int64
+			for _, run := range runs {
+				size += run.Size
+			}
+			Expect(size).To(BeNumerically("<=", 1000))
+
+			err = store.ReadRun("app1", "goal1", "c0", func(logstore.Line) error { return nil })
+			Expect(err).To(Equal(logstore.ErrRunNotFound))
+		})
+	})
+
+	Context("When a run finished longer ago than the maximum age", func() {
+		BeforeEach(func() {
+			run, err := store.StartRun("app1", "goal1", "c1", startTime.Add(-31*24*time.Hour))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(run.Write(lineAt(1, "first"))).To(Succeed())
+			Expect(run.Close()).To(Succeed())
+			Expect(store.FinishRun("app1", "goal1", "c1", time.Time{}, startTime.Add(-30*24*time.Hour), 0)).To(Succeed())
+		})
+
+		It("Should remove the run and the empty directories when pruned", func() {
+			Expect(store.Prune()).To(Succeed())
+
+			_, err := os.Stat(filepath.Join(dir, "app1"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+
+			runs, err := store.Runs("app1", "goal1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(runs).To(BeEmpty())
+		})
+	})
+
+	Context("When names would escape the directory of the store", func() {
+		It("Should refuse to record the run", func() {
+			_, err := store.StartRun("..", "goal1", "c1", startTime)
+			Expect(err).To(HaveOccurred())
+			_, err = store.StartRun("app1", "goal1", "../c1", startTime)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
+
+var _ = Describe("Search", func() {
+	var dir string
+	var store *logstore.Store
+
+	record := func(application, goal, containerID string, texts ...string) {
+		run, err := store.StartRun(application, goal, containerID, startTime)
+		Expect(err).ToNot(HaveOccurred())
+		for i, text := range texts {
+			Expect(run.Write(lineAt(i, text))).To(Succeed())
+		}
+		Expect(run.Close()).To(Succeed())
+	}
+
+	texts := func(lines []logstore.Line) []string {
+		result := []string{}
+		for _, line := range lines {
+			result = append(result, line.Text)
+		}
+		return result
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "apparatchik-logs")
+		Expect(err).ToNot(HaveOccurred())
+		store, err = logstore.New(dir, logstore.Options{})
+		Expect(err).ToNot(HaveOccurred())
+
+		record("app1", "goal1", "c1", "starting", "connecting", "ERROR connection refused", "retrying", "connected")
+		record("app1", "goal2", "c2", "Error: disk full")
+		record("app2", "goal1", "c3", "error in app2")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("Should find lines in all goals ignoring case", func() {
+		matches, truncated, err := store.Search(logstore.Query{Text: "error", Context: 1})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(truncated).To(BeFalse())
+		Expect(matches).To(HaveLen(3))
+
+		Expect(matches[0].Application).To(Equal("app1"))
+		Expect(matches[0].Goal).To(Equal("goal1"))
+		Expect(matches[0].ContainerID).To(Equal("c1"))
+		Expect(matches[0].Line.Text).To(Equal("ERROR connection refused\n"))
+		Expect(texts(matches[0].Before)).To(Equal([]string{"connecting\n"}))
+		Expect(texts(matches[0].After)).To(Equal([]string{"retrying\n"}))
+
+		Expect(matches[1].Goal).To(Equal("goal2"))
+		Expect(matches[2].Application).To(Equal("app2"))
+	})
+
+	It("Should only search the selected application and goal", func() {
+		matches, _, err := store.Search(logstore.Query{Text: "error", Application: "app1", Goal: "goal2"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matches).To(HaveLen(1))
+		Expect(matches[0].Line.Text).To(Equal("Error: disk full\n"))
+	})
+
+	It("Should skip lines before since", func() {
+		matches, _, err := store.Search(logstore.Query{Text: "conn", Since: startTime.Add(3 * time.Second)})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matches).To(HaveLen(1))
+		Expect(matches[0].Line.Text).To(Equal("connected\n"))
+	})
+
+	It("Should report when more lines matched than the limit", func() {
+		matches, truncated, err := store.Search(logstore.Query{Text: "error", Limit: 2})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matches).To(HaveLen(2))
+		Expect(truncated).To(BeTrue())
+	})
+})
@@ -0,0 +1,122 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// applicationLabel marks Docker objects created for an application.
+const applicationLabel = "apparatchik.application"
+
+// NetworkConfiguration describes an additional network goals of an
+// application can join.
+type NetworkConfiguration struct {
+	Driver     string            `json:"driver,omitempty"`
+	Internal   bool              `json:"internal,omitempty"`
+	Attachable bool              `json:"attachable,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+}
+
+// dockerObjectName returns Docker name of a network or a volume of the
+// application. Names of applications, networks and volumes can contain
+// underscores, the length of the application name tells where it ends, so
+// objects of different applications never get the same name.
+func dockerObjectName(applicationName string, name string) string {
+	objectName := fmt.Sprintf("ap_%d_%s", len(applicationName), applicationName)
+	if name != "" {
+		objectName += "_" + name
+	}
+	return objectName
+}
+
+// applicationNetworkName returns name of the bridge network all goals of the
+// application join, unless they set net.
+func applicationNetworkName(applicationName string) string {
+	return dockerObjectName(applicationName, "")
+}
+
+// networkName returns Docker name of a network declared in the application
+// descriptor.
+func networkName(applicationName string, name string) string {
+	return dockerObjectName(applicationName, name)
+}
+
+// dockerNetworks returns configurations of all networks of the application by
+// their Docker name.
+func (c *ApplicationConfiguration) dockerNetworks(applicationName string) map[string]*NetworkConfiguration {
+	networks := map[string]*NetworkConfiguration{
+		applicationNetworkName(applicationName): &NetworkConfiguration{},
+	}
+	for name, config := range c.Networks {
+		networks[networkName(applicationName, name)] = config
+	}
+	return networks
+}
+
+// createNetworks creates networks of the application that don't exist yet.
+func (a *Application) createNetworks() {
+	a.Lock()
+	networks := a.Configuration.dockerNetworks(a.Name)
+	a.Unlock()
+
+	for name, config := range networks {
+		err := createNetwork(a.DockerClient, a.Name, name, config)
+		if err != nil {
+			log.Error("Application ", a.Name, " could not create network ", name, ": ", err)
+		}
+	}
+}
+
+func createNetwork(dockerClient *client.Client, applicationName, name string, config *NetworkConfiguration) error {
+	_, err := dockerClient.NetworkInspect(context.Background(), name, false)
+	if err == nil {
+		return nil
+	}
+
+	if !client.IsErrNetworkNotFound(err) {
+		return err
+	}
+
+	labels := map[string]string{applicationLabel: applicationName}
+	for k, v := range config.Labels {
+		labels[k] = v
+	}
+
+	_, err = dockerClient.NetworkCreate(context.Background(), name, types.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         config.Driver,
+		Internal:       config.Internal,
+		Attachable:     config.Attachable,
+		Labels:         labels,
+	})
+
+	return err
+}
+
+// removeNetworks removes the networks, ignoring networks that don't exist.
+// Networks not created for this application are left alone.
+func (a *Application) removeNetworks(names []string) {
+	for _, name := range names {
+		network, err := a.DockerClient.NetworkInspect(context.Background(), name, false)
+		if client.IsErrNetworkNotFound(err) {
+			continue
+		}
+		if err != nil {
+			log.Error("Application ", a.Name, " could not inspect network ", name, ": ", err)
+			continue
+		}
+		if network.Labels[applicationLabel] != a.Name {
+			log.Warn("Application ", a.Name, " does not remove network ", name, " that belongs to application ", network.Labels[applicationLabel])
+			continue
+		}
+
+		err = a.DockerClient.NetworkRemove(context.Background(), name)
+		if err != nil && !client.IsErrNetworkNotFound(err) {
+			log.Error("Application ", a.Name, " could not remove network ", name, ": ", err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package core
+
+// GoalPlan describes the container that would be created for a goal.
+type GoalPlan struct {
+	DependsOn []string       `json:"depends_on"`
+	Container *ContainerSpec `json:"container"`
+}
+
+// ApplicationPlan describes what deploying an application descriptor would
+// do, without pulling images or starting any containers.
+type ApplicationPlan struct {
+	Name     string              `json:"name"`
+	MainGoal string              `json:"main_goal"`
+	Exists   bool                `json:"exists"`
+	Order    []string            `json:"order"`
+	Goals    map[string]GoalPlan `json:"goals"`
+	Diff     ConfigurationDiff   `json:"diff"`
+}
+
+// NewApplicationPlan creates plan for deploying config as application with
+// the given name. current is the configuration of the already deployed
+// application or nil if there is none.
+func NewApplicationPlan(name string, config, current *ApplicationConfiguration) (ApplicationPlan, error) {
+	err := ValidateApplicationName(name)
+	if err != nil {
+		return ApplicationPlan{}, err
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return ApplicationPlan{}, err
+	}
+
+	err = current.checkVolumeChanges(config)
+	if err != nil {
+		return ApplicationPlan{}, err
+	}
+
+	plan := ApplicationPlan{
+		Name:     name,
+		MainGoal: config.MainGoal,
+		Exists:   current != nil,
+		Order:    config.StartOrder(),
+		Goals:    map[string]GoalPlan{},
+		Diff:     current.Diff(config),
+	}
+
+	for goalName, goalConfig := range config.Goals {
+		plan.Goals[goalName] = GoalPlan{
+			DependsOn: goalConfig.dependsOn(),
+			Container: NewContainerSpec(name, goalName, config.Goals, config.Volumes),
+		}
+	}
+
+	return plan, nil
+}
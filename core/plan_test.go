@@ -0,0 +1,24 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanOfNewApplication(t *testing.T) {
+	plan, err := NewApplicationPlan("app", validConfiguration, nil)
+	require.Nil(t, err)
+	require.False(t, plan.Exists)
+	require.Equal(t, []string{"otherTest", "test"}, plan.Order)
+	require.Equal(t, []string{"otherTest", "test"}, plan.Diff.Added)
+	require.Equal(t, "ap_app_test", plan.Goals["test"].Container.Name)
+	require.Equal(t, "alpine:3.2", plan.Goals["test"].Container.Config.Image)
+}
+
+func TestPlanOfInvalidConfiguration(t *testing.T) {
+	config := validConfiguration.Clone()
+	config.MainGoal = ""
+	_, err := NewApplicationPlan("app", config, nil)
+	require.NotNil(t, err)
+}
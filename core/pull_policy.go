@@ -0,0 +1,22 @@
+package core
+
+import "fmt"
+
+const (
+	PullAlways       = "always"
+	PullIfNotPresent = "if_not_present"
+	PullNever        = "never"
+)
+
+// DefaultPullPolicy is used for goals that don't set their own pull_policy.
+var DefaultPullPolicy = PullAlways
+
+// ValidatePullPolicy makes sure the policy is one of always, if_not_present
+// and never.
+func ValidatePullPolicy(policy string) error {
+	switch policy {
+	case PullAlways, PullIfNotPresent, PullNever:
+		return nil
+	}
+	return fmt.Errorf("Unknown pull policy %q", policy)
+}
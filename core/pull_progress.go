@@ -0,0 +1,121 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+)
+
+// LayerProgress is the progress of pulling a single image layer.
+type LayerProgress struct {
+	ID      string `json:"id"`
+	Status  string `json:"status"`
+	Current int64  `json:"current"`
+	Total   int64  `json:"total"`
+}
+
+// PullProgress is the progress of pulling an image. Current and Total sum up
+// bytes of all layers with a known size.
+type PullProgress struct {
+	Layers  []LayerProgress `json:"layers"`
+	Current int64           `json:"current"`
+	Total   int64           `json:"total"`
+}
+
+// Percent returns the overall progress between 0 and 100.
+func (p *PullProgress) Percent() int {
+	if p.Total == 0 {
+		return 0
+	}
+	return int(p.Current * 100 / p.Total)
+}
+
+// pullMessage is one message of the JSON stream returned by the Docker image
+// pull API.
+type pullMessage struct {
+	ID             string `json:"id"`
+	Status         string `json:"status"`
+	ProgressDetail struct {
+		Current int64 `json:"current"`
+		Total   int64 `json:"total"`
+	} `json:"progressDetail"`
+	Error string `json:"error"`
+}
+
+// pullProgressTracker accumulates messages of a pull stream into per layer
+// progress.
+type pullProgressTracker struct {
+	layers map[string]*LayerProgress
+}
+
+func newPullProgressTracker() *pullProgressTracker {
+	return &pullProgressTracker{layers: map[string]*LayerProgress{}}
+}
+
+func (t *pullProgressTracker) update(msg pullMessage) {
+	// messages without a layer ID or with the tag as ID describe the whole
+	// image
+	if msg.ID == "" || strings.HasPrefix(msg.Status, "Pulling from") {
+		return
+	}
+
+	layer, found := t.layers[msg.ID]
+	if !found {
+		layer = &LayerProgress{ID: msg.ID}
+		t.layers[msg.ID] = layer
+	}
+
+	layer.Status = msg.Status
+
+	switch msg.Status {
+	case "Downloading":
+		layer.Current = msg.ProgressDetail.Current
+		layer.Total = msg.ProgressDetail.Total
+	case "Download complete", "Pull complete", "Already exists":
+		layer.Current = layer.Total
+	}
+}
+
+func (t *pullProgressTracker) progress() PullProgress {
+	progress := PullProgress{Layers: []LayerProgress{}}
+
+	for _, layer := range t.layers {
+		progress.Layers = append(progress.Layers, *layer)
+		progress.Current += layer.Current
+		progress.Total += layer.Total
+	}
+
+	sort.Slice(progress.Layers, func(i, j int) bool {
+		return progress.Layers[i].ID < progress.Layers[j].ID
+	})
+
+	return progress
+}
+
+// decodePullProgress reads the JSON stream of an image pull and calls
+// onProgress after every message. Errors reported in the stream are returned.
+func decodePullProgress(r io.Reader, onProgress func(PullProgress)) error {
+	decoder := json.NewDecoder(r)
+	tracker := newPullProgressTracker()
+
+	for {
+		msg := pullMessage{}
+		err := decoder.Decode(&msg)
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if msg.Error != "" {
+			return errors.New(msg.Error)
+		}
+
+		tracker.update(msg)
+		onProgress(tracker.progress())
+	}
+}
@@ -0,0 +1,42 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodePullProgressTracksLayers(t *testing.T) {
+	stream := `{"status":"Pulling from library/alpine","id":"3.2"}
+{"status":"Pulling fs layer","progressDetail":{},"id":"a"}
+{"status":"Pulling fs layer","progressDetail":{},"id":"b"}
+{"status":"Downloading","progressDetail":{"current":50,"total":100},"id":"a"}
+{"status":"Downloading","progressDetail":{"current":100,"total":300},"id":"b"}
+{"status":"Download complete","progressDetail":{},"id":"a"}
+`
+	progresses := []PullProgress{}
+	err := decodePullProgress(strings.NewReader(stream), func(p PullProgress) {
+		progresses = append(progresses, p)
+	})
+	require.Nil(t, err)
+	require.Len(t, progresses, 6)
+
+	last := progresses[len(progresses)-1]
+	require.Equal(t, []LayerProgress{
+		{ID: "a", Status: "Download complete", Current: 100, Total: 100},
+		{ID: "b", Status: "Downloading", Current: 100, Total: 300},
+	}, last.Layers)
+	require.Equal(t, int64(200), last.Current)
+	require.Equal(t, int64(400), last.Total)
+	require.Equal(t, 50, last.Percent())
+}
+
+func TestDecodePullProgressReturnsStreamErrors(t *testing.T) {
+	stream := `{"status":"Pulling fs layer","progressDetail":{},"id":"a"}
+{"errorDetail":{"message":"net/http: TLS handshake timeout"},"error":"net/http: TLS handshake timeout"}
+`
+	err := decodePullProgress(strings.NewReader(stream), func(p PullProgress) {})
+	require.NotNil(t, err)
+	require.Equal(t, "net/http: TLS handshake timeout", err.Error())
+}
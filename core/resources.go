@@ -0,0 +1,90 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	units "github.com/docker/go-units"
+)
+
+// UlimitConfiguration is a soft and hard limit of a resource. In the
+// descriptor it is either an object with "soft" and "hard" or a single
+// number used as both limits.
+type UlimitConfiguration struct {
+	Soft int64 `json:"soft"`
+	Hard int64 `json:"hard"`
+}
+
+func (u *UlimitConfiguration) UnmarshalJSON(data []byte) error {
+	var limit int64
+	if err := json.Unmarshal(data, &limit); err == nil {
+		u.Soft = limit
+		u.Hard = limit
+		return nil
+	}
+
+	type ulimit UlimitConfiguration
+	return json.Unmarshal(data, (*ulimit)(u))
+}
+
+// dockerUlimits returns ulimits of the goal sorted by their name.
+func (gc *GoalConfiguration) dockerUlimits() []*units.Ulimit {
+	if len(gc.Ulimits) == 0 {
+		return nil
+	}
+
+	names := []string{}
+	for name := range gc.Ulimits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ulimits := []*units.Ulimit{}
+	for _, name := range names {
+		limit := gc.Ulimits[name]
+		ulimits = append(ulimits, &units.Ulimit{Name: name, Soft: limit.Soft, Hard: limit.Hard})
+	}
+	return ulimits
+}
+
+// validateResources checks resource limits of the goal.
+func (gc *GoalConfiguration) validateResources() error {
+	if gc.Cpus < 0 {
+		return errors.New("cpus can't be negative")
+	}
+	if gc.MemReservation < 0 || gc.ShmSize < 0 {
+		return errors.New("memory options can't be negative")
+	}
+	if gc.MemLimit > 0 && gc.MemReservation > gc.MemLimit {
+		return errors.New("mem_reservation can't be greater than mem_limit")
+	}
+	if gc.PidsLimit < -1 {
+		return errors.New("pids_limit has to be -1 (unlimited) or positive")
+	}
+	if gc.OomScoreAdj < -1000 || gc.OomScoreAdj > 1000 {
+		return errors.New("oom_score_adj has to be between -1000 and 1000")
+	}
+	if gc.BlkioWeight != 0 && (gc.BlkioWeight < 10 || gc.BlkioWeight > 1000) {
+		return errors.New("blkio_weight has to be between 10 and 1000")
+	}
+	if gc.OomKillDisable && gc.MemLimit == 0 {
+		return errors.New("oom_kill_disable needs mem_limit to be set")
+	}
+	for name, limit := range gc.Ulimits {
+		if limit == nil {
+			return fmt.Errorf("ulimit %q has no limits", name)
+		}
+		_, err := units.ParseUlimit(fmt.Sprintf("%s=%d:%d", name, limit.Soft, limit.Hard))
+		if err != nil {
+			return err
+		}
+	}
+	for name := range gc.Sysctls {
+		if name == "" {
+			return errors.New("sysctl name can't be empty")
+		}
+	}
+	return nil
+}
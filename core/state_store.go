@@ -0,0 +1,62 @@
+package core
+
+import (
+	"errors"
+	"regexp"
+	"time"
+)
+
+var (
+	ErrInvalidApplicationName = errors.New("Invalid application name")
+	ErrRevisionNotFound       = errors.New("Revision not found")
+)
+
+// Revision is one deployed version of an application descriptor.
+type Revision struct {
+	Number        int                       `json:"number"`
+	Time          time.Time                 `json:"time"`
+	User          string                    `json:"user,omitempty"`
+	Configuration *ApplicationConfiguration `json:"configuration"`
+}
+
+// ApplicationState is the runtime state of an application that has to
+// survive apparatchik restarts.
+type ApplicationState struct {
+	Stopped        bool                            `json:"stopped"`
+	TransitionLogs map[string][]TransitionLogEntry `json:"transition_logs,omitempty"`
+}
+
+// StateStore persists application descriptors so that applications can be
+// restored when apparatchik is restarted. Every saved descriptor is kept as a
+// numbered revision.
+type StateStore interface {
+	SaveApplication(name string, config *ApplicationConfiguration, user string) (Revision, error)
+	DeleteApplication(name string) error
+	LoadApplications() (map[string]*ApplicationConfiguration, error)
+	Revisions(name string) ([]Revision, error)
+	Revision(name string, number int) (Revision, error)
+	SaveState(name string, state ApplicationState) error
+	// LoadState returns the zero ApplicationState when no state was saved.
+	LoadState(name string) (ApplicationState, error)
+	Close() error
+}
+
+var applicationNameExpression = regexp.MustCompile("^[0-9a-zA-Z_\\-][0-9a-zA-Z_\\.\\-]*$")
+
+// ValidateApplicationName makes sure that the name can be safely used as a
+// key of a state store, e.g. that it can't escape the state directory.
+func ValidateApplicationName(name string) error {
+	if !applicationNameExpression.MatchString(name) {
+		return ErrInvalidApplicationName
+	}
+	return nil
+}
+
+func newRevision(number int, config *ApplicationConfiguration, user string) Revision {
+	return Revision{
+		Number:        number,
+		Time:          time.Now().UTC(),
+		User:          user,
+		Configuration: config,
+	}
+}
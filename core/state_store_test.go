@@ -0,0 +1,150 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func withStateStores(t *testing.T, test func(t *testing.T, store StateStore)) {
+	dir, err := ioutil.TempDir("", "apparatchik-state")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	fileStore, err := NewFileStateStore(path.Join(dir, "files"))
+	require.Nil(t, err)
+	defer fileStore.Close()
+
+	boltStore, err := NewBoltStateStore(path.Join(dir, "state.db"))
+	require.Nil(t, err)
+	defer boltStore.Close()
+
+	t.Run("file", func(t *testing.T) { test(t, fileStore) })
+	t.Run("bolt", func(t *testing.T) { test(t, boltStore) })
+}
+
+func TestStateStoreSavesAndLoadsApplications(t *testing.T) {
+	withStateStores(t, func(t *testing.T, store StateStore) {
+		_, err := store.SaveApplication("app1", validConfiguration, "alice")
+		require.Nil(t, err)
+		_, err = store.SaveApplication("app1", validConfiguration, "alice")
+		require.Nil(t, err)
+
+		applications, err := store.LoadApplications()
+		require.Nil(t, err)
+		require.Equal(t, map[string]*ApplicationConfiguration{"app1": validConfiguration}, applications)
+	})
+}
+
+func TestStateStoreDeletesApplications(t *testing.T) {
+	withStateStores(t, func(t *testing.T, store StateStore) {
+		_, err := store.SaveApplication("app1", validConfiguration, "alice")
+		require.Nil(t, err)
+		require.Nil(t, store.DeleteApplication("app1"))
+		require.Nil(t, store.DeleteApplication("app1"))
+
+		applications, err := store.LoadApplications()
+		require.Nil(t, err)
+		require.Empty(t, applications)
+
+		revisions, err := store.Revisions("app1")
+		require.Nil(t, err)
+		require.Empty(t, revisions)
+	})
+}
+
+func TestStateStoreKeepsNumberedRevisions(t *testing.T) {
+	withStateStores(t, func(t *testing.T, store StateStore) {
+		changed := validConfiguration.Clone()
+		changed.MainGoal = "otherTest"
+
+		first, err := store.SaveApplication("app1", validConfiguration, "alice")
+		require.Nil(t, err)
+		require.Equal(t, 1, first.Number)
+
+		second, err := store.SaveApplication("app1", changed, "bob")
+		require.Nil(t, err)
+		require.Equal(t, 2, second.Number)
+
+		revisions, err := store.Revisions("app1")
+		require.Nil(t, err)
+		require.Len(t, revisions, 2)
+		require.Equal(t, "alice", revisions[0].User)
+		require.Equal(t, validConfiguration, revisions[0].Configuration)
+		require.Equal(t, "bob", revisions[1].User)
+		require.Equal(t, changed, revisions[1].Configuration)
+
+		revision, err := store.Revision("app1", 1)
+		require.Nil(t, err)
+		require.Equal(t, validConfiguration, revision.Configuration)
+
+		_, err = store.Revision("app1", 3)
+		require.Equal(t, ErrRevisionNotFound, err)
+
+		applications, err := store.LoadApplications()
+		require.Nil(t, err)
+		require.Equal(t, changed, applications["app1"])
+	})
+}
+
+func TestStateStoreSavesApplicationState(t *testing.T) {
+	withStateStores(t, func(t *testing.T, store StateStore) {
+		state, err := store.LoadState("app1")
+		require.Nil(t, err)
+		require.Equal(t, ApplicationState{}, state)
+
+		saved := ApplicationState{
+			Stopped: true,
+			TransitionLogs: map[string][]TransitionLogEntry{
+				"test": {{Time: time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC), Status: "running"}},
+			},
+		}
+		require.Nil(t, store.SaveState("app1", saved))
+
+		state, err = store.LoadState("app1")
+		require.Nil(t, err)
+		require.Equal(t, saved, state)
+
+		applications, err := store.LoadApplications()
+		require.Nil(t, err)
+		require.Empty(t, applications)
+
+		require.Nil(t, store.DeleteApplication("app1"))
+
+		state, err = store.LoadState("app1")
+		require.Nil(t, err)
+		require.Equal(t, ApplicationState{}, state)
+	})
+}
+
+func TestStateStoreRejectsInvalidApplicationNames(t *testing.T) {
+	withStateStores(t, func(t *testing.T, store StateStore) {
+		for _, name := range []string{"", ".", "..", "../app", "a/b", ".hidden"} {
+			_, err := store.SaveApplication(name, validConfiguration, "")
+			require.Equal(t, ErrInvalidApplicationName, err, name)
+			require.Equal(t, ErrInvalidApplicationName, store.DeleteApplication(name), name)
+		}
+	})
+}
+
+func TestFileStateStoreDoesNotLeaveTemporaryFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apparatchik-state")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := NewFileStateStore(dir)
+	require.Nil(t, err)
+
+	_, err = store.SaveApplication("app1", validConfiguration, "alice")
+	require.Nil(t, err)
+
+	files, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	require.Len(t, files, 2)
+	require.Equal(t, "app1.json", files[0].Name())
+	require.Equal(t, "app1.revisions", files[1].Name())
+}
@@ -73,4 +73,23 @@ var _ = Describe("Tracker", func() {
 
 	})
 
+	Describe("EntriesSince()", func() {
+		var first, second stats.Entry
+		BeforeEach(func() {
+			first = stats.Entry{Time: zeroTime, CPU: 1, Memory: 1}
+			second = stats.Entry{Time: zeroTime.Add(100 * time.Millisecond), CPU: 2, Memory: 2}
+			tracker.Add(first)
+			tracker.Add(second)
+		})
+		It("Should return entries after the time", func() {
+			Expect(tracker.EntriesSince(zeroTime)).To(Equal([]stats.Entry{second}))
+		})
+		It("Should return all entries for a time before them", func() {
+			Expect(tracker.EntriesSince(zeroTime.Add(-time.Millisecond))).To(Equal([]stats.Entry{first, second}))
+		})
+		It("Should return no entries for a time after them", func() {
+			Expect(tracker.EntriesSince(zeroTime.Add(time.Second))).To(Equal([]stats.Entry{}))
+		})
+	})
+
 })
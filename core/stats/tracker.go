@@ -2,10 +2,22 @@ package stats
 
 import "time"
 
+// Entry is a sample of resource usage of a container. CPU is the CPU time
+// in nanoseconds used since the previous sample and CPUPercent the same
+// relative to a single CPU, so a container using two CPUs fully is at 200%.
+// Network and block I/O are totals since the container started.
 type Entry struct {
-	Time   time.Time
-	CPU    uint64
-	Memory uint64
+	Time        time.Time `json:"time"`
+	CPU         uint64    `json:"cpu"`
+	CPUPercent  float64   `json:"cpu_percent"`
+	Memory      uint64    `json:"memory"`
+	MemoryLimit uint64    `json:"memory_limit"`
+	MemoryCache uint64    `json:"memory_cache"`
+	NetworkRx   uint64    `json:"network_rx"`
+	NetworkTx   uint64    `json:"network_tx"`
+	BlockRead   uint64    `json:"block_read"`
+	BlockWrite  uint64    `json:"block_write"`
+	Pids        uint64    `json:"pids"`
 }
 
 type Tracker struct {
@@ -53,3 +65,13 @@ func (t *Tracker) Add(entry Entry) {
 func (t *Tracker) Entries() []Entry {
 	return t.entries
 }
+
+// EntriesSince returns entries sampled after the time.
+func (t *Tracker) EntriesSince(since time.Time) []Entry {
+	for i, e := range t.entries {
+		if e.Time.After(since) {
+			return append([]Entry{}, t.entries[i:]...)
+		}
+	}
+	return []Entry{}
+}
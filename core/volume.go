@@ -0,0 +1,222 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	volumetypes "github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+)
+
+const (
+	// VolumePolicyRemove removes volumes of containers and named volumes of
+	// the application when it is terminated.
+	VolumePolicyRemove = "remove"
+	// VolumePolicyKeep keeps all volumes when the application is terminated.
+	VolumePolicyKeep = "keep"
+)
+
+// VolumeConfiguration describes a named volume goals of an application can
+// mount.
+type VolumeConfiguration struct {
+	Driver     string            `json:"driver,omitempty"`
+	DriverOpts map[string]string `json:"driver_opts,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+}
+
+// ErrVolumeChanged is returned when an update changes the definition of a
+// volume that the volume policy keeps. Such volumes can't be recreated.
+var ErrVolumeChanged = errors.New("Definition of a volume changed, but the volume policy keeps volumes")
+
+// volumeName returns Docker name of a volume declared in the application
+// descriptor.
+func volumeName(applicationName string, name string) string {
+	return dockerObjectName(applicationName, name)
+}
+
+// parseVolume splits a volume of a goal into the source, the path in the
+// container and the mode. Source is either a path on the host or name of a
+// volume of the application.
+func parseVolume(volume string) (source, target, mode string) {
+	parts := strings.Split(volume, ":")
+	switch {
+	case len(parts) == 1:
+		return parts[0], parts[0], ""
+	case len(parts) == 2 && (parts[1] == "rw" || parts[1] == "ro"):
+		return parts[0], parts[0], parts[1]
+	case len(parts) == 2:
+		return parts[0], parts[1], ""
+	default:
+		return parts[0], parts[1], strings.Join(parts[2:], ":")
+	}
+}
+
+func isHostPath(source string) bool {
+	return strings.HasPrefix(source, "/")
+}
+
+func isRelativePath(source string) bool {
+	return source == "." || source == ".." || source == "~" ||
+		strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../") || strings.HasPrefix(source, "~/")
+}
+
+// volumeBind returns the bind of a goal volume as understood by Docker.
+// Volumes not declared by the application are passed to Docker as they are,
+// Docker creates them when the container is created.
+func volumeBind(applicationName string, volumes map[string]*VolumeConfiguration, volume string) string {
+	source, target, mode := parseVolume(volume)
+	if _, declared := volumes[source]; declared {
+		source = volumeName(applicationName, source)
+	}
+	bind := source + ":" + target
+	if mode != "" {
+		bind += ":" + mode
+	}
+	return bind
+}
+
+// resolveRelativeVolumes replaces relative host paths of goal volumes with
+// paths in dir. Descriptors stored before relative paths were rejected
+// mounted them relative to the working directory of apparatchik.
+func (c *ApplicationConfiguration) resolveRelativeVolumes(dir string) {
+	for _, goal := range c.Goals {
+		for i, volume := range goal.Volumes {
+			source, target, mode := parseVolume(volume)
+			if !strings.HasPrefix(source, ".") {
+				continue
+			}
+			source = filepath.Join(dir, source)
+			if strings.HasPrefix(target, ".") {
+				target = source
+			}
+			volume = source + ":" + target
+			if mode != "" {
+				volume += ":" + mode
+			}
+			goal.Volumes[i] = volume
+		}
+	}
+}
+
+// ChangedVolumes returns names of volumes that are declared differently in
+// the new configuration. Volumes that are removed are not included.
+func (c *ApplicationConfiguration) ChangedVolumes(newConfig *ApplicationConfiguration) []string {
+	changed := []string{}
+	if c == nil {
+		return changed
+	}
+	for name, volume := range c.Volumes {
+		newVolume, found := newConfig.Volumes[name]
+		if found && !reflect.DeepEqual(volume, newVolume) {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// checkVolumeChanges rejects a new configuration that changes volumes when
+// the new volume policy keeps them. Changed volumes are only recreated when
+// the policy removes volumes.
+func (c *ApplicationConfiguration) checkVolumeChanges(newConfig *ApplicationConfiguration) error {
+	if !newConfig.removesVolumes() && len(c.ChangedVolumes(newConfig)) > 0 {
+		return ErrVolumeChanged
+	}
+	return nil
+}
+
+// mountsVolume returns true when the goal mounts any of the named volumes.
+func mountsVolume(goal *GoalConfiguration, volumes []string) bool {
+	for _, volume := range goal.Volumes {
+		source, _, _ := parseVolume(volume)
+		if contains(volumes, source) {
+			return true
+		}
+	}
+	return false
+}
+
+// removesVolumes returns true when volumes should be removed together with
+// containers and the application.
+func (c *ApplicationConfiguration) removesVolumes() bool {
+	return c.VolumePolicy != VolumePolicyKeep
+}
+
+// dockerVolumes returns configurations of all named volumes of the
+// application by their Docker name.
+func (c *ApplicationConfiguration) dockerVolumes(applicationName string) map[string]*VolumeConfiguration {
+	volumes := map[string]*VolumeConfiguration{}
+	for name, config := range c.Volumes {
+		volumes[volumeName(applicationName, name)] = config
+	}
+	return volumes
+}
+
+// createVolumes creates named volumes of the application that don't exist
+// yet. Existing volumes are left as they are.
+func (a *Application) createVolumes() {
+	a.Lock()
+	volumes := a.Configuration.dockerVolumes(a.Name)
+	a.Unlock()
+
+	for name, config := range volumes {
+		err := createVolume(a.DockerClient, a.Name, name, config)
+		if err != nil {
+			log.Error("Application ", a.Name, " could not create volume ", name, ": ", err)
+		}
+	}
+}
+
+func createVolume(dockerClient *client.Client, applicationName, name string, config *VolumeConfiguration) error {
+	_, err := dockerClient.VolumeInspect(context.Background(), name)
+	if err == nil {
+		return nil
+	}
+
+	if !client.IsErrVolumeNotFound(err) {
+		return err
+	}
+
+	labels := map[string]string{applicationLabel: applicationName}
+	for k, v := range config.Labels {
+		labels[k] = v
+	}
+
+	_, err = dockerClient.VolumeCreate(context.Background(), volumetypes.VolumesCreateBody{
+		Name:       name,
+		Driver:     config.Driver,
+		DriverOpts: config.DriverOpts,
+		Labels:     labels,
+	})
+
+	return err
+}
+
+// removeVolumes removes the volumes, ignoring volumes that don't exist.
+// Volumes not created for this application are left alone.
+func (a *Application) removeVolumes(names []string) {
+	for _, name := range names {
+		volume, err := a.DockerClient.VolumeInspect(context.Background(), name)
+		if client.IsErrVolumeNotFound(err) {
+			continue
+		}
+		if err != nil {
+			log.Error("Application ", a.Name, " could not inspect volume ", name, ": ", err)
+			continue
+		}
+		if volume.Labels[applicationLabel] != a.Name {
+			log.Warn("Application ", a.Name, " does not remove volume ", name, " that belongs to application ", volume.Labels[applicationLabel])
+			continue
+		}
+
+		err = a.DockerClient.VolumeRemove(context.Background(), name, false)
+		if err != nil && !client.IsErrVolumeNotFound(err) {
+			log.Error("Application ", a.Name, " could not remove volume ", name, ": ", err)
+		}
+	}
+}
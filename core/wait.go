@@ -0,0 +1,170 @@
+package core
+
+import (
+	"strings"
+	"time"
+)
+
+// Results of waiting for an application to settle.
+const (
+	// WaitSucceeded means that the main goal is running or terminated.
+	WaitSucceeded = "succeeded"
+	// WaitFailed means that a goal failed or has an error.
+	WaitFailed = "failed"
+	// WaitTimedOut means that the application didn't settle in time.
+	WaitTimedOut = "timed_out"
+)
+
+// MaxWait limits how long a request can wait for an application.
+const MaxWait = 10 * time.Minute
+
+// waitRecheckInterval is how often the status is checked when no events
+// arrive, in case the subscription was disconnected.
+const waitRecheckInterval = time.Second
+
+// ApplicationWaiter waits for an application to settle. It watches the
+// application from its creation, so that no change is missed between
+// creating, updating or starting the application and waiting for it.
+type ApplicationWaiter struct {
+	apparatchik  *Apparatchik
+	name         string
+	subscription *EventSubscription
+	// before are statuses of goals when watching started, transitioned are
+	// goals that changed their status since then.
+	before       map[string]string
+	transitioned map[string]bool
+	// lastEventID is the ID of the last received event, watching resumes
+	// after it when the subscription has been disconnected.
+	lastEventID string
+}
+
+// WatchApplication starts watching the application, which doesn't have to
+// exist yet.
+func (a *Apparatchik) WatchApplication(name string) *ApplicationWaiter {
+	waiter := &ApplicationWaiter{
+		apparatchik:  a,
+		name:         name,
+		subscription: a.watchEvents(name, ""),
+		before:       map[string]string{},
+		transitioned: map[string]bool{},
+	}
+
+	if application, err := a.ApplicationByName(name); err == nil {
+		for goalName, goal := range application.Status().Goals {
+			waiter.before[goalName] = goal.Status
+		}
+	}
+
+	return waiter
+}
+
+// watchEvents subscribes to events of the application. With lastEventID,
+// events published after it are delivered first.
+func (a *Apparatchik) watchEvents(name string, lastEventID string) *EventSubscription {
+	return a.SubscribeEvents(EventFilter{
+		Applications: []string{name},
+		Types:        []string{EventApplicationUpdate, EventApplicationTerminated, EventGoalUpdate, EventGoalTransition},
+	}, lastEventID != "", lastEventID)
+}
+
+// Wait blocks until the goals needed by the main goal settled, any of them
+// failed or the timeout expired. Only goals in changed, e.g. recreated or
+// added by an update, and goals that were not running or terminated when
+// watching started are judged, and only after their status changed. It
+// returns the status of the application at that moment and the result.
+func (w *ApplicationWaiter) Wait(changed []string, timeout time.Duration) (ApplicationStatus, string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	recheck := time.NewTicker(waitRecheckInterval)
+	defer recheck.Stop()
+
+	for {
+		application, err := w.apparatchik.ApplicationByName(w.name)
+		if err != nil {
+			return ApplicationStatus{}, "", err
+		}
+
+		application.Lock()
+		config := application.Configuration
+		application.Unlock()
+
+		status := application.Status()
+		if result := waitResult(status, w.judgedGoals(config, changed), w.transitioned); result != "" {
+			return status, result, nil
+		}
+
+		select {
+		case evt, ok := <-w.subscription.Events():
+			if !ok {
+				w.subscription = w.apparatchik.watchEvents(w.name, w.lastEventID)
+				break
+			}
+			w.lastEventID = evt.ID
+			if evt.Type == EventGoalTransition {
+				w.transitioned[evt.Goal] = true
+			}
+		case <-recheck.C:
+		case <-timer.C:
+			return application.Status(), WaitTimedOut, nil
+		}
+	}
+}
+
+func (w *ApplicationWaiter) Close() {
+	w.subscription.Close()
+}
+
+// judgedGoals returns goals needed by the main goal that were changed or
+// hadn't settled before watching started. Goals that were running and were
+// not touched are left out, as well as goals that failed before and are not
+// needed any more.
+func (w *ApplicationWaiter) judgedGoals(config *ApplicationConfiguration, changed []string) []string {
+	goals := []string{}
+	for _, name := range config.requiredGoals(config.MainGoal) {
+		before, found := w.before[name]
+		if !found || contains(changed, name) || !isSettledStatus(before) {
+			goals = append(goals, name)
+		}
+	}
+	return goals
+}
+
+// waitResult returns the result of waiting for the goals with the status,
+// or an empty string when they haven't settled yet. Goals that didn't
+// change their status yet still show their status from before the request
+// and are not judged.
+func waitResult(status ApplicationStatus, goals []string, transitioned map[string]bool) string {
+	settled := true
+	for _, name := range goals {
+		if !transitioned[name] {
+			settled = false
+			continue
+		}
+		goalStatus := status.Goals[name].Status
+		if isFailedStatus(goalStatus) {
+			return WaitFailed
+		}
+		if !isSettledStatus(goalStatus) {
+			settled = false
+		}
+	}
+
+	if settled {
+		return WaitSucceeded
+	}
+
+	return ""
+}
+
+// isSettledStatus returns true for goals that are running, paused or
+// terminated.
+func isSettledStatus(status string) bool {
+	return IsRunningStatus(status) || status == "paused" || status == "terminated"
+}
+
+// isFailedStatus returns true for goals that failed, including goals waiting
+// to be restarted after a failure.
+func isFailedStatus(status string) bool {
+	return status == "failed" || status == "crash_loop_backoff" || strings.HasPrefix(status, "error")
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func applicationWithStatuses(statuses map[string]string) ApplicationStatus {
+	goals := map[string]GoalStatus{}
+	for name, status := range statuses {
+		goals[name] = GoalStatus{Name: name, Status: status}
+	}
+	return ApplicationStatus{Name: "app1", Goals: goals, MainGoal: "web"}
+}
+
+var allTransitioned = map[string]bool{"web": true, "db": true}
+
+func TestWaitSucceedsWhenGoalsRunOrTerminated(t *testing.T) {
+	goals := []string{"db", "web"}
+	require.Equal(t, WaitSucceeded, waitResult(applicationWithStatuses(map[string]string{"web": "running", "db": "running"}), goals, allTransitioned))
+	require.Equal(t, WaitSucceeded, waitResult(applicationWithStatuses(map[string]string{"web": "healthy", "db": "terminated"}), goals, allTransitioned))
+	require.Equal(t, WaitSucceeded, waitResult(applicationWithStatuses(map[string]string{"web": "terminated", "db": "stopped"}), []string{"web"}, allTransitioned))
+}
+
+func TestWaitFailsWhenAnyJudgedGoalFails(t *testing.T) {
+	goals := []string{"db", "web"}
+	require.Equal(t, WaitFailed, waitResult(applicationWithStatuses(map[string]string{"web": "running", "db": "failed"}), goals, allTransitioned))
+	require.Equal(t, WaitFailed, waitResult(applicationWithStatuses(map[string]string{"web": "crash_loop_backoff"}), []string{"web"}, allTransitioned))
+	require.Equal(t, WaitFailed, waitResult(applicationWithStatuses(map[string]string{"web": "waiting_for_dependencies", "db": "error: no such image"}), goals, allTransitioned))
+}
+
+func TestWaitContinuesWhileApplicationStarts(t *testing.T) {
+	goals := []string{"db", "web"}
+	require.Equal(t, "", waitResult(applicationWithStatuses(map[string]string{"web": "waiting_for_dependencies", "db": "fetching_image"}), goals, allTransitioned))
+	require.Equal(t, "", waitResult(applicationWithStatuses(map[string]string{"web": "starting", "db": "running"}), goals, allTransitioned))
+}
+
+func TestWaitIgnoresStatusesFromBeforeTheRequest(t *testing.T) {
+	status := applicationWithStatuses(map[string]string{"web": "running", "db": "failed"})
+	require.Equal(t, "", waitResult(status, []string{"db", "web"}, map[string]bool{}))
+	require.Equal(t, "", waitResult(status, []string{"db", "web"}, map[string]bool{"web": true}))
+	require.Equal(t, WaitFailed, waitResult(status, []string{"db", "web"}, map[string]bool{"db": true}))
+}
+
+func TestWaitJudgesChangedAndUnsettledGoalsNeededByMainGoal(t *testing.T) {
+	config := &ApplicationConfiguration{
+		MainGoal: "web",
+		Goals: map[string]*GoalConfiguration{
+			"web":     &GoalConfiguration{Image: "alpine:3.2", Links: []string{"db", "new"}, RunAfter: []string{"migrate"}},
+			"db":      &GoalConfiguration{Image: "alpine:3.2"},
+			"migrate": &GoalConfiguration{Image: "alpine:3.2"},
+			"cache":   &GoalConfiguration{Image: "alpine:3.2"},
+			"new":     &GoalConfiguration{Image: "alpine:3.2"},
+		},
+	}
+
+	waiter := &ApplicationWaiter{before: map[string]string{
+		"web":     "running",
+		"db":      "running",
+		"migrate": "crash_loop_backoff",
+		"cache":   "failed",
+	}}
+
+	require.Equal(t, []string{"migrate", "new"}, waiter.judgedGoals(config, nil))
+	require.Equal(t, []string{"db", "migrate", "new"}, waiter.judgedGoals(config, []string{"db", "cache"}))
+
+	waiter.before = map[string]string{}
+	require.Equal(t, []string{"db", "migrate", "new", "web"}, waiter.judgedGoals(config, nil))
+}
+
+func TestWaitResumesDisconnectedSubscription(t *testing.T) {
+	goal := newTestGoal(&GoalConfiguration{Image: "alpine:3.2"})
+	goal.CurrentStatus = "starting"
+	application := goal.application
+	hub := NewEventHub()
+	application.events = hub
+	apparatchik := &Apparatchik{applications: map[string]*Application{"app": application}, events: hub}
+
+	waiter := apparatchik.WatchApplication("app")
+	defer waiter.Close()
+
+	application.publishEvent(Event{Type: EventApplicationUpdate})
+	waiter.subscription.Close()
+	goal.SetCurrentStatus("running")
+
+	_, result, err := waiter.Wait([]string{"web"}, 500*time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, WaitSucceeded, result)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/websocket"
+	"github.com/julienschmidt/httprouter"
+	"github.com/netice9/apparatchik/core"
+)
+
+// eventKeepaliveInterval is how often a comment is sent over idle event
+// streams, so that proxies don't close them.
+const eventKeepaliveInterval = 15 * time.Second
+
+// eventWriteTimeout limits how long writing an event to a WebSocket may take.
+const eventWriteTimeout = 10 * time.Second
+
+// GetEvents streams events of all applications, or of the application in
+// the path, as Server-Sent Events. Requests upgrading the connection get the
+// events as JSON WebSocket messages instead.
+func (a *API) GetEvents(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	query := r.URL.Query()
+
+	filter, err := eventFilter(query)
+	if err != nil {
+		respondWithStatus(400, err, w)
+		return
+	}
+
+	if applicationName := ps.ByName("applicationName"); applicationName != "" {
+		_, err = a.apparatchick.ApplicationByName(applicationName)
+		if err != nil {
+			respondWithError(err, w)
+			return
+		}
+		filter.Applications = []string{applicationName}
+	}
+
+	resume, lastEventID := parseLastEventID(r)
+
+	subscription := a.apparatchick.SubscribeEvents(filter, resume, lastEventID)
+	defer subscription.Close()
+
+	if websocket.IsWebSocketUpgrade(r) {
+		streamEventsToWebSocket(w, r, subscription)
+	} else {
+		streamServerSentEvents(w, r, subscription)
+	}
+}
+
+// eventFilter reads the app, goal and type parameters. Every parameter can
+// be repeated or list comma separated values.
+func eventFilter(query url.Values) (core.EventFilter, error) {
+	filter := core.EventFilter{
+		Applications: queryList(query["app"]),
+		Goals:        queryList(query["goal"]),
+		Types:        queryList(query["type"]),
+	}
+
+	for _, eventType := range filter.Types {
+		known := false
+		for _, t := range core.EventTypes {
+			known = known || t == eventType
+		}
+		if !known {
+			return filter, fmt.Errorf("Unknown event type %q", eventType)
+		}
+	}
+
+	return filter, nil
+}
+
+func queryList(values []string) []string {
+	list := []string{}
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// parseLastEventID returns the ID of the last event seen by the client from
+// the Last-Event-ID header sent by reconnecting EventSource clients, or the
+// last_event_id parameter.
+func parseLastEventID(r *http.Request) (bool, string) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+	return value != "", value
+}
+
+func streamServerSentEvents(w http.ResponseWriter, r *http.Request, subscription *core.EventSubscription) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondWithStatus(500, errors.New("Streaming is not supported"), w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(eventKeepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			_, err := fmt.Fprint(w, ": keepalive\n\n")
+			if err != nil {
+				return
+			}
+		case evt, ok := <-subscription.Events():
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(evt)
+			if err != nil {
+				log.Error("Could not encode event ", evt.ID, ": ", err)
+				continue
+			}
+			_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", evt.ID, evt.Type, data)
+			if err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func streamEventsToWebSocket(w http.ResponseWriter, r *http.Request, subscription *core.EventSubscription) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Error("Could not upgrade events connection: ", err)
+		return
+	}
+	defer conn.Close()
+
+	// messages of the client are discarded, reading only detects when the
+	// connection is closed
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case evt, ok := <-subscription.Events():
+			if !ok {
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+			if err := conn.WriteJSON(evt); err != nil {
+				return
+			}
+		}
+	}
+}
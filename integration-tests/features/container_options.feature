@@ -33,6 +33,18 @@ Scenario: set all container options
   And CpusetMems should be set
   And ReadonlyRootfs should be set
   And VolumeDriver should be set
+  And NanoCpus should be set
+  And MemoryReservation should be set
+  And PidsLimit should be set
+  And Ulimits should be set
+  And ShmSize should be set
+  And Sysctls should be set
+  And OomScoreAdj should be set
+  And OomKillDisable should be set
+  And BlkioWeight should be set
+  And Init should be set
+  And StopSignal should be set
+  And StopTimeout should be set
 
 
 # TODO: pid
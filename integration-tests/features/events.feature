@@ -0,0 +1,16 @@
+Feature: event stream
+
+Scenario: waiting for a service to run using the event stream
+  Given I create an application with one service
+  When I wait for the service to be running using the event stream
+  Then the event should describe the transition of the service
+
+Scenario: filtering events by an unknown type
+  Given I create an application with one service
+  When I request events of an unknown type
+  Then the service should respond with 400 status code
+
+Scenario: events of a non existing application
+  Given there are no applications
+  When I request events of a non-existing application
+  Then the service should respond with 404 status code
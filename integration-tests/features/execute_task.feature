@@ -16,7 +16,10 @@ Scenario: executing a task that won't fail
   Given I create an application with one task that will execute succesfully
   When I wait for the task to finish
   Then the exit code of the task should be 0
+  And the status of the task should describe the exited container
   And I should be able to retreive the logs of the task
+  And I should be able to retreive the logs of the task with timestamps
+  And the stderr of the task should be empty
 
 Scenario: executing a task that depends on another task - happy path
   Given I create an application with one task depending on another task
@@ -36,10 +39,27 @@ Scenario: deleting an existing application
   When I delete the application
   Then the application should not exist anymore
 
+Scenario: retreiving logs of a run after the application is deleted
+  Given I create an application with one task that will execute succesfully
+  And I wait for the task to finish
+  When I delete the application
+  Then the run of the task should be listed with exit code 0
+  And I should be able to retreive the logs of the run
+
+Scenario: searching logs of all goals
+  Given I create an application with one task that will execute succesfully
+  And I wait for the task to finish
+  When I search logs of all goals for "EXECUTED"
+  Then the search should find the output of the task
+
+Scenario: retreiving logs of a non-existing goal
+  Given I create an application with one task that will execute succesfully
+  When I retreive the logs of a non-existing goal
+  Then the service should respond with 404 status code
+
 #TODO: test for run_after pointing to itself
 #TODO: test for run_after pointing to a task and not a service
 #TODO: test for main goal not set
 #TODO: test for main goal not existing
 #TODO: test for image not specified
-#TODO: test for logs of non existing goal
 
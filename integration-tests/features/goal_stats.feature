@@ -9,3 +9,9 @@ Feature: goal stats
     Given I create an application with one service that uses some cpu
     When I wait for the service to start
     Then the service should have current stats
+
+  Scenario: recent stats of a service
+    Given I create an application with one service that uses some cpu
+    When I wait for the service to start
+    Then the service should have stats since a second ago
+    And the service should have no stats since the future
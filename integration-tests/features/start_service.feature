@@ -27,3 +27,17 @@ Scenario: starting service that links another service
   When I create an application with a service linked to another service with a link alias
   Then both services should be running
   And second service should be linked to the first service using the alias
+
+Scenario: creating an application and waiting for it to run
+  When I create an application with one service waiting up to 60s
+  Then the service should respond with 201 status code
+  And the response should show the service running
+
+Scenario: creating an application with a failing goal and waiting for it
+  When I create an application with a failing task waiting up to 60s
+  Then the service should respond with 422 status code
+  And the response should show the task failed
+
+Scenario: waiting for an application longer than it takes to settle
+  When I create an application with a slowly starting service waiting up to 1s
+  Then the service should respond with 202 status code
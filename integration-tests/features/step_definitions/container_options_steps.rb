@@ -41,6 +41,24 @@ When(/^I start a new application with one task specifying all container options$
         tty: false,
         cpu_shares: 73,
         cpuset: "0",
+        cpuset_mems: "0",
+        cpus: 0.5,
+        mem_reservation: 4_000_000,
+        pids_limit: 100,
+        ulimits: {
+          nproc: 65535,
+          nofile: { soft: 20000, hard: 40000 }
+        },
+        shm_size: 1_000_000,
+        sysctls: {
+          "net.core.somaxconn": "1024"
+        },
+        oom_score_adj: 500,
+        oom_kill_disable: true,
+        blkio_weight: 300,
+        init: true,
+        stop_signal: "SIGINT",
+        stop_grace_period: "30s",
         read_only: true,
         volume_driver: "local"
 
@@ -179,6 +197,57 @@ Then(/^ReadonlyRootfs should be set$/) do
 end
 
 Then(/^VolumeDriver should be set$/) do
-  expect(inspect_goal('task1').to_h['Config']['VolumeDriver']).to eq("local")
+  expect(inspect_goal('task1').to_h['HostConfig']['VolumeDriver']).to eq("local")
+end
+
+
+Then(/^NanoCpus should be set$/) do
+  expect(inspect_goal('task1').to_h['HostConfig']['NanoCpus']).to eq(500_000_000)
+end
+
+Then(/^MemoryReservation should be set$/) do
+  expect(inspect_goal('task1').to_h['HostConfig']['MemoryReservation']).to eq(4_000_000)
+end
+
+Then(/^PidsLimit should be set$/) do
+  expect(inspect_goal('task1').to_h['HostConfig']['PidsLimit']).to eq(100)
+end
+
+Then(/^Ulimits should be set$/) do
+  expect(inspect_goal('task1').to_h['HostConfig']['Ulimits']).to eq([
+    {"Name"=>"nofile", "Hard"=>40000, "Soft"=>20000},
+    {"Name"=>"nproc", "Hard"=>65535, "Soft"=>65535}
+  ])
+end
+
+Then(/^ShmSize should be set$/) do
+  expect(inspect_goal('task1').to_h['HostConfig']['ShmSize']).to eq(1_000_000)
 end
 
+Then(/^Sysctls should be set$/) do
+  expect(inspect_goal('task1').to_h['HostConfig']['Sysctls']).to eq({"net.core.somaxconn"=>"1024"})
+end
+
+Then(/^OomScoreAdj should be set$/) do
+  expect(inspect_goal('task1').to_h['HostConfig']['OomScoreAdj']).to eq(500)
+end
+
+Then(/^OomKillDisable should be set$/) do
+  expect(inspect_goal('task1').to_h['HostConfig']['OomKillDisable']).to eq(true)
+end
+
+Then(/^BlkioWeight should be set$/) do
+  expect(inspect_goal('task1').to_h['HostConfig']['BlkioWeight']).to eq(300)
+end
+
+Then(/^Init should be set$/) do
+  expect(inspect_goal('task1').to_h['HostConfig']['Init']).to eq(true)
+end
+
+Then(/^StopSignal should be set$/) do
+  expect(inspect_goal('task1').to_h['Config']['StopSignal']).to eq("SIGINT")
+end
+
+Then(/^StopTimeout should be set$/) do
+  expect(inspect_goal('task1').to_h['Config']['StopTimeout']).to eq(30)
+end
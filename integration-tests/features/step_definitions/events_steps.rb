@@ -0,0 +1,43 @@
+require 'timeout'
+
+# reads server-sent events until the block returns true
+def read_events(url, query)
+  buffer = ""
+  Timeout.timeout(30) do
+    HTTParty.get(url, query: query, stream_body: true) do |fragment|
+      buffer << fragment
+      while (i = buffer.index("\n\n"))
+        message = buffer.slice!(0, i + 2)
+        data = message.lines.find { |line| line.start_with?("data: ") }
+        next unless data
+        return if yield JSON.parse(data.sub("data: ", ""))
+      end
+    end
+  end
+end
+
+When(/^I wait for the service to be running using the event stream$/) do
+  # last_event_id=0 replays the kept events, so the transition is seen even
+  # if the service started before the stream was opened
+  read_events("http://apparatchik:8080/api/v1.0/applications/#{@app_name}/events", {type: "goal_transition", goal: "service1", last_event_id: 0}) do |event|
+    @event = event
+    event["data"]["status"] == "running"
+  end
+end
+
+Then(/^the event should describe the transition of the service$/) do
+  expect(@event["type"]).to eq("goal_transition")
+  expect(@event["application"]).to eq(@app_name)
+  expect(@event["goal"]).to eq("service1")
+  expect(@event["id"]).to match(/\A[0-9a-z]+-[0-9]+\z/)
+  expect(Time.parse(@event["time"])).to be_an_instance_of(Time)
+  expect(get_application.to_h["goals"]["service1"]["status"]).to eq("running")
+end
+
+When(/^I request events of an unknown type$/) do
+  @response = HTTParty.get("http://apparatchik:8080/api/v1.0/applications/#{@app_name}/events", query: {type: "whatever"})
+end
+
+When(/^I request events of a non\-existing application$/) do
+  @response = HTTParty.get("http://apparatchik:8080/api/v1.0/applications/whatever/events")
+end
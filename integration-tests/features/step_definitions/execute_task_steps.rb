@@ -35,6 +35,14 @@ Then(/^the exit code of the task should be (\d+)$/) do |expected_code|
   expect(get_application.to_h["goals"]["task1"]["exit_code"]).to eq(expected_code.to_i)
 end
 
+Then(/^the status of the task should describe the exited container$/) do
+  goal = get_application.to_h["goals"]["task1"]
+  expect(goal["oom_killed"]).to be_nil
+  expect(goal["restart_count"]).to eq(0)
+  expect(goal["container_id"]).to eq(inspect_goal('task1').to_h['Id'])
+  expect(Time.parse(goal["started_at"])).to be <= Time.parse(goal["finished_at"])
+end
+
 Then(/^I should be able to retreive the logs of the task$/) do
   response = HTTParty.get("http://apparatchik:8080/api/v1.0/applications/#{@app_name}/goals/task1/logs")
   expect(response.code).to eq(200)
@@ -42,6 +50,61 @@ Then(/^I should be able to retreive the logs of the task$/) do
   expect(response.body).to eq("executed\n")
 end
 
+Then(/^I should be able to retreive the logs of the task with timestamps$/) do
+  response = HTTParty.get("http://apparatchik:8080/api/v1.0/applications/#{@app_name}/goals/task1/logs?timestamps=true&tail=1")
+  expect(response.code).to eq(200)
+  time, text = response.body.split(' ', 2)
+  expect(Time.iso8601(time)).to be_an_instance_of(Time)
+  expect(text).to eq("executed\n")
+end
+
+Then(/^the stderr of the task should be empty$/) do
+  response = HTTParty.get("http://apparatchik:8080/api/v1.0/applications/#{@app_name}/goals/task1/logs?stdout=false")
+  expect(response.code).to eq(200)
+  expect(response.body).to eq("")
+end
+
+Then(/^the run of the task should be listed with exit code (\d+)$/) do |expected_code|
+  timed_retry do
+    response = HTTParty.get("http://apparatchik:8080/api/v1.0/applications/#{@app_name}/goals/task1/runs")
+    expect(response.code).to eq(200)
+    runs = response.parsed_response
+    expect(runs.length).to eq(1)
+    expect(runs[0]["exit_code"]).to eq(expected_code.to_i)
+    expect(Time.parse(runs[0]["started_at"])).to be <= Time.parse(runs[0]["finished_at"])
+    @run_id = runs[0]["container_id"]
+  end
+end
+
+Then(/^I should be able to retreive the logs of the run$/) do
+  response = HTTParty.get("http://apparatchik:8080/api/v1.0/applications/#{@app_name}/goals/task1/runs/#{@run_id}/logs")
+  expect(response.code).to eq(200)
+  expect(response.headers['content-type']).to eq('text/plain')
+  expect(response.body).to eq("executed\n")
+end
+
+When(/^I search logs of all goals for "([^"]*)"$/) do |text|
+  timed_retry do
+    @response = HTTParty.get("http://apparatchik:8080/api/v1.0/logs/search", query: {q: text, since: "10m"})
+    expect(@response.code).to eq(200)
+    expect(@response.to_h["matches"].select { |m| m["application"] == @app_name }).not_to be_empty
+  end
+end
+
+Then(/^the search should find the output of the task$/) do
+  matches = @response.to_h["matches"].select { |m| m["application"] == @app_name }
+  expect(matches.length).to eq(1)
+  expect(matches[0]["goal"]).to eq("task1")
+  expect(matches[0]["container_id"]).to eq(inspect_goal('task1').to_h['Id'])
+  expect(matches[0]["line"]["text"]).to eq("executed\n")
+  expect(matches[0]["line"]["stream"]).to eq("stdout")
+  expect(@response.to_h["truncated"]).to eq(false)
+end
+
+When(/^I retreive the logs of a non-existing goal$/) do
+  @response = HTTParty.get("http://apparatchik:8080/api/v1.0/applications/#{@app_name}/goals/taskX/logs")
+end
+
 
 Given(/^I create an application with one task depending on another task$/) do
 response = create_application(
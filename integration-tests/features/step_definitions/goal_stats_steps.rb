@@ -22,13 +22,16 @@ Then(/^the service should have some cpu and memory stats$/) do
   expect(goal_stats('service1').code).to eq(200)
 
   timed_retry retries: 30 do
-    expect(goal_stats('service1').to_h['cpu_stats']).not_to be_empty
-  end
-
-  timed_retry do
-    expect(goal_stats('service1').to_h['mem_stats']).not_to be_empty
+    entries = goal_stats_entries('service1')
+    expect(entries).not_to be_empty
+    expect(entries.last['cpu_percent']).to be > 0
   end
 
+  entry = goal_stats_entries('service1').last
+  expect(entry['memory']).to be > 0
+  expect(entry['memory_limit']).to be > 0
+  expect(entry['pids']).to be > 0
+  expect(entry).to include('time', 'cpu', 'memory_cache', 'network_rx', 'network_tx', 'block_read', 'block_write')
 end
 
 Then(/^the service should have current stats$/) do
@@ -40,3 +43,18 @@ Then(/^the service should have current stats$/) do
 
 
 end
+
+Then(/^the service should have stats since a second ago$/) do
+  timed_retry do
+    entries = goal_stats_entries('service1', since: '1s')
+    expect(entries).not_to be_empty
+    entries.each do |entry|
+      expect(Time.parse(entry['time'])).to be > Time.now - 5
+    end
+  end
+end
+
+Then(/^the service should have no stats since the future$/) do
+  since = (Time.now + 3600).utc.iso8601
+  expect(goal_stats_entries('service1', since: since)).to be_empty
+end
@@ -46,8 +46,9 @@ Then(/^both services should be running$/) do
 end
 
 Then(/^second service should be linked to the first service$/) do
-  response = inspect_goal('service2')
-  expect(response.to_h['HostConfig']['Links']).to match([/service1$/])
+  network = "ap_#{@app_name.length}_#{@app_name}"
+  expect(inspect_goal('service2').to_h['NetworkSettings']['Networks'].keys).to include(network)
+  expect(inspect_goal('service1').to_h['NetworkSettings']['Networks'][network]['Aliases']).to include('service1')
 end
 
 When(/^I create an application with a service linked to another service with a link alias$/) do
@@ -70,6 +71,70 @@ When(/^I create an application with a service linked to another service with a l
 end
 
 Then(/^second service should be linked to the first service using the alias$/) do
-  response = inspect_goal('service2')
-  expect(response.to_h['HostConfig']['Links']).to match([/awesome_service$/])
+  network = "ap_#{@app_name.length}_#{@app_name}"
+  expect(inspect_goal('service2').to_h['NetworkSettings']['Networks'].keys).to include(network)
+  expect(inspect_goal('service1').to_h['NetworkSettings']['Networks'][network]['Aliases']).to include('awesome_service')
+end
+
+def create_application_and_wait(request, wait)
+  @app_name = SecureRandom.uuid
+  @response = HTTParty.put("http://apparatchik:8080/api/v1.0/applications/#{@app_name}",
+    query: {wait: wait},
+    body: request.to_json,
+    headers: {
+        'Content-Type' => 'application/json',
+        'Accept' => 'application/json'
+    },
+    timeout: 90
+  )
+end
+
+When(/^I create an application with one service waiting up to (\w+)$/) do |wait|
+  create_application_and_wait({
+    goals: {
+      service1: {
+        image: "alpine:3.2",
+        command: ["/bin/sh","-c","sleep 99999999"]
+      }
+    },
+    main_goal: 'service1'
+  }, wait)
+end
+
+When(/^I create an application with a failing task waiting up to (\w+)$/) do |wait|
+  create_application_and_wait({
+    goals: {
+      task1: {
+        image: "alpine:3.2",
+        command: ["/bin/sh","-c","exit 1"]
+      }
+    },
+    main_goal: 'task1'
+  }, wait)
+end
+
+When(/^I create an application with a slowly starting service waiting up to (\w+)$/) do |wait|
+  create_application_and_wait({
+    goals: {
+      service1: {
+        image: "alpine:3.2",
+        command: ["/bin/sh","-c","sleep 99999999"],
+        run_after: ["task1"]
+      },
+      task1: {
+        image: "alpine:3.2",
+        command: ["/bin/sh","-c","sleep 10"]
+      }
+    },
+    main_goal: 'service1'
+  }, wait)
+end
+
+Then(/^the response should show the service running$/) do
+  expect(@response.to_h["goals"]["service1"]["status"]).to eq("running")
+end
+
+Then(/^the response should show the task failed$/) do
+  expect(@response.to_h["goals"]["task1"]["status"]).to eq("failed")
+  expect(@response.to_h["goals"]["task1"]["exit_code"]).to eq(1)
 end
@@ -44,8 +44,9 @@ def transition_log(goal_name)
 end
 
 
-def goal_stats(goal_name)
+def goal_stats(goal_name, query = {})
   HTTParty.get("http://apparatchik:8080/api/v1.0/applications/#{@app_name}/goals/#{goal_name}/stats",
+    query: query,
     headers: {
         'Accept' => 'application/json'
     }
@@ -58,4 +59,10 @@ def goal_current_stats(goal_name)
         'Accept' => 'application/json'
     }
   )
+end
+
+def goal_stats_entries(goal_name, query = {})
+  response = goal_stats(goal_name, query)
+  expect(response.code).to eq(200)
+  response.parsed_response
 end
\ No newline at end of file
@@ -1,6 +1,7 @@
 require 'httparty'
 require 'pry'
 require 'securerandom'
+require 'time'
 require 'docker'
 
 Before do
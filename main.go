@@ -1,11 +1,15 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"path"
+	"time"
 
 	"github.com/docker/docker/client"
 	"github.com/netice9/apparatchik/core"
+	"github.com/netice9/apparatchik/core/logstore"
 	"gopkg.in/urfave/cli.v2"
 )
 
@@ -21,16 +25,85 @@ func main() {
 				DefaultText: "HTTP Port",
 				EnvVars:     []string{"PORT"},
 			},
+			&cli.StringFlag{
+				Name:        "state-store",
+				Value:       "file",
+				DefaultText: "Type of the state store: file or bolt",
+				EnvVars:     []string{"STATE_STORE"},
+			},
+			&cli.StringFlag{
+				Name:        "state-dir",
+				Value:       "/applications",
+				DefaultText: "Directory where the application state is stored",
+				EnvVars:     []string{"STATE_DIR"},
+			},
+			&cli.StringFlag{
+				Name:        "pull-policy",
+				Value:       core.PullAlways,
+				DefaultText: "Default image pull policy of goals: always, if_not_present or never",
+				EnvVars:     []string{"PULL_POLICY"},
+			},
+			&cli.StringFlag{
+				Name:        "log-dir",
+				DefaultText: "Directory where output of goals is stored, logs in the state directory by default",
+				EnvVars:     []string{"LOG_DIR"},
+			},
+			&cli.Int64Flag{
+				Name:        "log-max-file-size",
+				Value:       logstore.DefaultMaxFileSize,
+				DefaultText: "Size in bytes at which a log file of a run is rotated",
+				EnvVars:     []string{"LOG_MAX_FILE_SIZE"},
+			},
+			&cli.IntFlag{
+				Name:        "log-max-files",
+				Value:       logstore.DefaultMaxFiles,
+				DefaultText: "Number of log files kept for a run",
+				EnvVars:     []string{"LOG_MAX_FILES"},
+			},
+			&cli.Int64Flag{
+				Name:        "log-max-goal-size",
+				Value:       logstore.DefaultMaxGoalSize,
+				DefaultText: "Size in bytes of stored output of a goal, oldest runs are removed first",
+				EnvVars:     []string{"LOG_MAX_GOAL_SIZE"},
+			},
+			&cli.DurationFlag{
+				Name:        "log-max-age",
+				Value:       logstore.DefaultMaxAge,
+				DefaultText: "Time for which output of finished runs is kept",
+				EnvVars:     []string{"LOG_MAX_AGE"},
+			},
 		},
 	}
 
 	app.Action = func(ctx *cli.Context) error {
+		err := core.ValidatePullPolicy(ctx.String("pull-policy"))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		core.DefaultPullPolicy = ctx.String("pull-policy")
+
 		dockerClient, err := client.NewEnvClient()
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		apparatchick, err := core.StartApparatchik(dockerClient)
+		store, err := newStateStore(ctx.String("state-store"), ctx.String("state-dir"))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		defer store.Close()
+
+		logStore, err := newLogStore(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		core.LogStore = logStore
+		go pruneLogs(logStore)
+
+		apparatchick, err := core.StartApparatchik(dockerClient, store)
 
 		if err != nil {
 			panic(err)
@@ -38,33 +111,6 @@ func main() {
 
 		core.ApparatchikInstance = apparatchick
 
-		// files, err := ioutil.ReadDir("/applications")
-		//
-		// if err != nil {
-		// 	panic(err)
-		// }
-		//
-		// for _, file := range files {
-		// 	name := file.Name()
-		// 	if strings.HasSuffix(name, ".json") {
-		// 		applicationName := name[0 : len(name)-len(".json")]
-		// 		data, err := ioutil.ReadFile("/applications/" + name)
-		// 		if err != nil {
-		// 			panic(err)
-		// 		}
-		//
-		// 		config := core.ApplicationConfiguration{}
-		//
-		// 		if err = json.Unmarshal(data, &config); err != nil {
-		// 			panic(err)
-		// 		}
-		//
-		// 		apparatchick.NewApplication(applicationName, &config)
-		//
-		// 	}
-		//
-		// }
-
 		return startHttpServer(apparatchick, dockerClient, ctx.Int("port"))
 
 	}
@@ -72,3 +118,41 @@ func main() {
 	app.Run(os.Args)
 
 }
+
+func newStateStore(storeType, dir string) (core.StateStore, error) {
+	switch storeType {
+	case "file":
+		return core.NewFileStateStore(dir)
+	case "bolt":
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return nil, err
+		}
+		return core.NewBoltStateStore(path.Join(dir, "apparatchik.db"))
+	}
+	return nil, fmt.Errorf("Unknown state store type %q", storeType)
+}
+
+func newLogStore(ctx *cli.Context) (*logstore.Store, error) {
+	dir := ctx.String("log-dir")
+	if dir == "" {
+		dir = path.Join(ctx.String("state-dir"), "logs")
+	}
+	return logstore.New(dir, logstore.Options{
+		MaxFileSize: ctx.Int64("log-max-file-size"),
+		MaxFiles:    ctx.Int("log-max-files"),
+		MaxGoalSize: ctx.Int64("log-max-goal-size"),
+		MaxAge:      ctx.Duration("log-max-age"),
+	})
+}
+
+// pruneLogs removes old output also of goals and applications that don't
+// run any more.
+func pruneLogs(store *logstore.Store) {
+	for range time.Tick(time.Hour) {
+		err := store.Prune()
+		if err != nil {
+			log.Println("Could not prune logs: ", err)
+		}
+	}
+}
@@ -53,7 +53,7 @@ func (aa *AddApplication) OnUserEvent(evt *reactor.UserEvent) {
 		aa.appName = evt.Value
 		aa.render()
 	case "deploy_btn":
-		_, err := core.ApparatchikInstance.NewApplication(aa.appName, aa.config)
+		_, err := core.ApparatchikInstance.NewApplication(aa.appName, aa.config, "")
 
 		if err != nil {
 			aa.alert = err
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
 	"sync"
 
 	"github.com/draganm/go-reactor"
@@ -49,6 +50,12 @@ func (a *Application) OnUserEvent(evt *reactor.UserEvent) {
 		a.showModal = true
 	case "deleteCancelButton":
 		a.showModal = false
+	case "stopButton":
+		_, err := core.ApparatchikInstance.StopApplication(a.app.Name)
+		a.alert = err
+	case "startButton":
+		_, err := core.ApparatchikInstance.StartApplication(a.app.Name)
+		a.alert = err
 	case "deleteConfirmButton":
 		a.showModal = false
 		a.alert = errors.New("Deleting application.")
@@ -94,12 +101,19 @@ func (a *Application) render() {
 		row := goalRowUI.DeepCopy()
 		row.SetElementText("goal_name", name)
 		row.SetElementAttribute("goal_name", "href", fmt.Sprintf("#/apps/%s/%s", a.app.Name, goal.Name))
-		if goal.Status == "running" {
+		if core.IsRunningStatus(goal.Status) {
 			row.SetElementAttribute("goal_term_link", "href", fmt.Sprintf("#/apps/%s/%s/xterm", a.app.Name, goal.Name))
 		} else {
 			row.SetElementAttribute("goal_term_link", "disabled", true)
 		}
-		row.SetElementText("goal_state", goal.Status)
+		row.SetElementText("goal_state", goalStatusText(goal))
+		if goal.PullProgress != nil {
+			percent := goal.PullProgress.Percent()
+			row.SetElementAttribute("pull_progress", "now", percent)
+			row.SetElementAttribute("pull_progress", "label", fmt.Sprintf("%d%%", percent))
+		} else {
+			row.DeleteChild("pull_progress")
+		}
 		view.AppendChild("goal_table_body", row)
 	}
 
@@ -109,6 +123,13 @@ func (a *Application) render() {
 		view.DeleteChild("alert")
 	}
 
+	if a.status.Stopped {
+		view.DeleteChild("stopButton")
+	} else {
+		view.DeleteChild("startButton")
+	}
+
+	view.SetElementAttribute("searchButton", "href", fmt.Sprintf("#/search/%s", a.app.Name))
 	view.SetElementAttribute("delete_confirm_modal", "show", a.showModal)
 	view.SetElementText("application_name", a.app.Name)
 
@@ -125,7 +146,10 @@ func (a *Application) Unmount() {
 var goalRowUI = reactor.MustParseDisplayModel(`
   <tr id="row">
     <td ><a id="goal_name" href="#" className="btn btn-default"/></td>
-    <td id="goal_state" />
+    <td>
+      <span id="goal_state" />
+      <bs.ProgressBar id="pull_progress" int:now="0" bool:active="true" bool:striped="true" />
+    </td>
     <td id="goal_actions">
 			<bs.ButtonToolbar>
 				<bs.Button id="goal_term_link">XTerm</bs.Button>
@@ -157,7 +181,12 @@ var applicationUI = reactor.MustParseDisplayModel(`
         </dd>
       </dl>
 
-      <bs.Button id="deleteButton" bsStyle="danger" reportEvents="click">Delete!</bs.Button>
+      <bs.ButtonToolbar>
+        <bs.Button id="stopButton" bsStyle="warning" reportEvents="click">Stop</bs.Button>
+        <bs.Button id="startButton" bsStyle="success" reportEvents="click">Start</bs.Button>
+        <bs.Button id="searchButton" href="#"><bs.Glyphicon glyph="search"/> Search Logs</bs.Button>
+        <bs.Button id="deleteButton" bsStyle="danger" reportEvents="click">Delete!</bs.Button>
+      </bs.ButtonToolbar>
 			<bs.Modal id="delete_confirm_modal" bool:show="false" reportEvents="hide">
 					<bs.Modal.Header>
 						<bs.Modal.Title>Confirm Deleting Application</bs.Modal.Title>
@@ -176,3 +205,20 @@ var applicationUI = reactor.MustParseDisplayModel(`
     </bs.Panel>
   </div>
 `)
+
+// goalStatusText returns the status of the goal together with the health of
+// its container, unless the health is already the status, and the reason why
+// the container was killed.
+func goalStatusText(goal core.GoalStatus) string {
+	details := []string{}
+	if goal.Health != "" && goal.Health != goal.Status {
+		details = append(details, goal.Health)
+	}
+	if goal.OOMKilled && !core.IsRunningStatus(goal.Status) {
+		details = append(details, "oom_killed")
+	}
+	if len(details) == 0 {
+		return goal.Status
+	}
+	return fmt.Sprintf("%s (%s)", goal.Status, strings.Join(details, ", "))
+}
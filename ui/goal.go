@@ -29,6 +29,7 @@ func GoalFactory(ctx reactor.ScreenContext) reactor.Screen {
 
 	return &Goal{
 		ctx:  ctx,
+		app:  app,
 		goal: goal,
 	}
 }
@@ -36,10 +37,12 @@ func GoalFactory(ctx reactor.ScreenContext) reactor.Screen {
 type Goal struct {
 	sync.Mutex
 	ctx   reactor.ScreenContext
+	app   *core.Application
 	goal  *core.Goal
 	stat  core.GoalStatus
 	stats []stats.Entry
 	tail  string
+	alert error
 }
 
 func (g *Goal) Mount() {
@@ -53,12 +56,65 @@ func (g *Goal) Mount() {
 }
 
 func (g *Goal) OnUserEvent(evt *reactor.UserEvent) {
+	g.Lock()
+	defer g.Unlock()
+
+	var err error
+
+	switch evt.ElementID {
+	case "startButton":
+		_, err = g.app.StartGoal(g.goal.Name)
+	case "stopButton":
+		_, err = g.app.StopGoal(g.goal.Name)
+	case "restartButton":
+		_, err = g.app.RestartGoal(g.goal.Name)
+	case "killButton":
+		_, err = g.app.KillGoal(g.goal.Name)
+	case "pauseButton":
+		_, err = g.app.PauseGoal(g.goal.Name)
+	case "unpauseButton":
+		_, err = g.app.UnpauseGoal(g.goal.Name)
+	case "pullButton":
+		_, err = g.app.PullGoal(g.goal.Name)
+	default:
+		return
+	}
+
+	g.alert = err
+	g.render()
 }
 
 func (g *Goal) render() {
 	view := renderGraph(g.stats)
 
 	view.SetElementText("out", g.tail)
+	view.SetElementText("goal_status", goalStatusText(g.stat))
+	view.SetElementText("goal_details", goalDetailsText(g.stat))
+	renderTransitionLog(view, g.goal.TransitionLog(), time.Now())
+
+	if g.alert != nil {
+		view.SetElementText("alert", g.alert.Error())
+	} else {
+		view.DeleteChild("alert")
+	}
+
+	if g.stat.Status != "retrying_pull" && !strings.HasPrefix(g.stat.Status, "error: ") {
+		view.DeleteChild("pullButton")
+	}
+
+	switch g.stat.Status {
+	case "running", "healthy", "unhealthy":
+		view.DeleteChild("startButton")
+		view.DeleteChild("unpauseButton")
+	case "paused":
+		view.DeleteChild("startButton")
+		view.DeleteChild("pauseButton")
+	default:
+		view.DeleteChild("stopButton")
+		view.DeleteChild("killButton")
+		view.DeleteChild("pauseButton")
+		view.DeleteChild("unpauseButton")
+	}
 
 	g.ctx.UpdateScreen(&reactor.DisplayUpdate{
 		Model: WithNavigation(view, [][]string{{"Applications", "#/"}, {g.goal.ApplicationName, fmt.Sprintf("#/apps/%s", g.goal.ApplicationName)}, {g.goal.Name, fmt.Sprintf("#/apps/%s/%s", g.goal.ApplicationName, g.goal.Name)}}),
@@ -66,6 +122,42 @@ func (g *Goal) render() {
 
 }
 
+// goalDetailsText describes when the container of the goal started and
+// exited, how often it was restarted and why it exited.
+func goalDetailsText(goal core.GoalStatus) string {
+	details := []string{fmt.Sprintf("Restarts: %d", goal.RestartCount)}
+	if goal.ContainerID != "" {
+		details = append(details, "Container: "+shortID(goal.ContainerID))
+	}
+	if goal.StartedAt != nil {
+		if core.IsRunningStatus(goal.Status) {
+			details = append(details, "Up: "+time.Since(*goal.StartedAt).Truncate(time.Second).String())
+		} else {
+			details = append(details, "Started: "+goal.StartedAt.Format(time.RFC3339))
+		}
+	}
+	if goal.FinishedAt != nil && !core.IsRunningStatus(goal.Status) {
+		details = append(details, "Finished: "+goal.FinishedAt.Format(time.RFC3339))
+	}
+	if goal.ExitCode != nil && !core.IsRunningStatus(goal.Status) {
+		details = append(details, fmt.Sprintf("Exit code: %d", *goal.ExitCode))
+	}
+	if goal.OOMKilled {
+		details = append(details, "Killed: out of memory")
+	}
+	if goal.Error != "" {
+		details = append(details, "Error: "+goal.Error)
+	}
+	return strings.Join(details, " | ")
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
 func (g *Goal) Unmount() {
 	g.goal.RemoveListener("update", g.onGoalStatus)
 	g.goal.RemoveListener("tail", g.onGoalTail)
@@ -95,6 +187,20 @@ func (g *Goal) onGoalTail(tail string) {
 
 var goalUI = reactor.MustParseDisplayModel(`
 	<div>
+		<bs.Panel id="control_panel" header="Control">
+			<bs.Alert id="alert" bsStyle="danger"/>
+			<p>Status: <span id="goal_status"/></p>
+			<p id="goal_details"/>
+			<bs.ButtonToolbar>
+				<bs.Button id="startButton" bsStyle="success" reportEvents="click">Start</bs.Button>
+				<bs.Button id="stopButton" bsStyle="warning" reportEvents="click">Stop</bs.Button>
+				<bs.Button id="restartButton" bsStyle="primary" reportEvents="click">Restart</bs.Button>
+				<bs.Button id="pauseButton" reportEvents="click">Pause</bs.Button>
+				<bs.Button id="unpauseButton" reportEvents="click">Unpause</bs.Button>
+				<bs.Button id="killButton" bsStyle="danger" reportEvents="click">Kill</bs.Button>
+				<bs.Button id="pullButton" bsStyle="info" reportEvents="click">Pull Image</bs.Button>
+			</bs.ButtonToolbar>
+		</bs.Panel>
 	  <bs.Panel id="goal_panel" header="CPU Stats">
 			<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 450 130" width="100%" className="chart">
 				<g transform="translate(10,20)">
@@ -125,12 +231,94 @@ var goalUI = reactor.MustParseDisplayModel(`
 				</g>
 			</svg>
 	  </bs.Panel>
+		<bs.Panel id="transitions_panel" header="Status Timeline">
+			<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 450 30" width="100%" className="chart">
+				<g id="timeline" transform="translate(10,5)"/>
+			</svg>
+			<bs.Table bool:condensed="true" bool:hover="true">
+				<thead>
+					<tr>
+						<th>Time</th>
+						<th>Status</th>
+					</tr>
+				</thead>
+				<tbody id="transitions_table_body"/>
+			</bs.Table>
+		</bs.Panel>
 		<bs.Panel id="output_panel" header="Output">
 			<pre id="out" className="pre-scrollable" />
 		</bs.Panel>
 	</div>
 `)
 
+var timelineSegmentUI = reactor.MustParseDisplayModel(`
+	<rect id="segment" y="0" height="20" strokeWidth="0.5" stroke="#fff"/>
+`)
+
+var transitionRowUI = reactor.MustParseDisplayModel(`
+	<tr>
+		<td id="transition_time"/>
+		<td id="transition_status"/>
+	</tr>
+`)
+
+// maxTransitionRows is the number of the most recent transitions listed
+// below the timeline.
+const maxTransitionRows = 20
+
+// renderTransitionLog draws the status transitions of the goal as a timeline
+// from the first transition until now, and lists the most recent ones.
+func renderTransitionLog(view *reactor.DisplayModel, entries []core.TransitionLogEntry, now time.Time) {
+	if len(entries) == 0 {
+		return
+	}
+
+	const width = 430.0
+	start := entries[0].Time
+	total := now.Sub(start)
+	if total <= 0 {
+		total = time.Second
+	}
+
+	for i, entry := range entries {
+		end := now
+		if i+1 < len(entries) {
+			end = entries[i+1].Time
+		}
+		x := float64(entry.Time.Sub(start)) / float64(total) * width
+		w := float64(end.Sub(entry.Time)) / float64(total) * width
+
+		segment := timelineSegmentUI.DeepCopy()
+		segment.SetElementAttribute("segment", "x", fmt.Sprintf("%.2f", x))
+		segment.SetElementAttribute("segment", "width", fmt.Sprintf("%.2f", w))
+		segment.SetElementAttribute("segment", "fill", statusColor(entry.Status))
+		view.AppendChild("timeline", segment)
+	}
+
+	for i := len(entries) - 1; i >= 0 && i >= len(entries)-maxTransitionRows; i-- {
+		row := transitionRowUI.DeepCopy()
+		row.SetElementText("transition_time", entries[i].Time.Format(time.RFC3339))
+		row.SetElementText("transition_status", entries[i].Status)
+		view.AppendChild("transitions_table_body", row)
+	}
+}
+
+// statusColor returns the color of a goal status on the timeline.
+func statusColor(status string) string {
+	switch {
+	case status == "running" || status == "healthy":
+		return "#2ecc40"
+	case status == "unhealthy" || status == "failed" || status == "crash_loop_backoff" || strings.HasPrefix(status, "error: "):
+		return "#ff4136"
+	case status == "paused":
+		return "#ffdc00"
+	case status == "stopped" || status == "terminated" || status == "not_running":
+		return "#aaaaaa"
+	default:
+		return "#0074d9"
+	}
+}
+
 type sample struct {
 	time  time.Time
 	value float64
@@ -140,7 +328,7 @@ func renderGraph(entries []stats.Entry) *reactor.DisplayModel {
 	cpuSamples := []sample{}
 	memSamples := []sample{}
 	for _, e := range entries {
-		cpuSamples = append(cpuSamples, sample{e.Time, float64(e.CPU) / 1e7})
+		cpuSamples = append(cpuSamples, sample{e.Time, e.CPUPercent})
 		memSamples = append(memSamples, sample{e.Time, float64(e.Memory) / (1024 * 1024)})
 	}
 
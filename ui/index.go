@@ -20,6 +20,7 @@ var navigationUI = reactor.MustParseDisplayModel(`
   			</bs.Navbar.Brand>
   		</bs.Navbar.Header>
   		<bs.Nav bool:pullRight="true">
+  		 	<bs.NavItem href="#/search"><bs.Glyphicon glyph="search"/></bs.NavItem>
   		 	<bs.NavItem href="#/add_application"><bs.Glyphicon glyph="plus"/></bs.NavItem>
   		 </bs.Nav>
   	</bs.Navbar>
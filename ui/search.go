@@ -0,0 +1,201 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/draganm/go-reactor"
+	"github.com/netice9/apparatchik/core"
+	"github.com/netice9/apparatchik/core/logstore"
+)
+
+// Search finds lines in stored output of all goals, or of the goals of one
+// application.
+type Search struct {
+	sync.Mutex
+	ctx         reactor.ScreenContext
+	query       string
+	application string
+	goal        string
+	since       string
+	matches     []logstore.Match
+	truncated   bool
+	searched    bool
+	alert       error
+}
+
+func SearchFactory(ctx reactor.ScreenContext) reactor.Screen {
+	return &Search{
+		ctx:         ctx,
+		application: ctx.Params["application"],
+	}
+}
+
+func (s *Search) Mount() {
+	s.Lock()
+	defer s.Unlock()
+	s.render()
+}
+
+func (s *Search) OnUserEvent(evt *reactor.UserEvent) {
+	s.Lock()
+	defer s.Unlock()
+
+	switch evt.ElementID {
+	case "search_query":
+		s.query = evt.Value
+	case "search_application":
+		s.application = evt.Value
+	case "search_goal":
+		s.goal = evt.Value
+	case "search_since":
+		s.since = evt.Value
+	case "search_button":
+		s.search()
+	}
+	s.render()
+}
+
+func (s *Search) search() {
+	s.matches = nil
+	s.truncated = false
+	s.alert = nil
+	s.searched = false
+
+	if core.LogStore == nil {
+		s.alert = fmt.Errorf("Output of goals is not stored")
+		return
+	}
+
+	if strings.TrimSpace(s.query) == "" {
+		s.alert = fmt.Errorf("Enter the text to search for")
+		return
+	}
+
+	since, err := core.ParseLogTime(s.since, time.Now())
+	if err != nil {
+		s.alert = fmt.Errorf("Invalid since %q", s.since)
+		return
+	}
+
+	s.matches, s.truncated, err = core.LogStore.Search(logstore.Query{
+		Text:        s.query,
+		Application: s.application,
+		Goal:        s.goal,
+		Since:       since,
+		Context:     logstore.DefaultSearchContext,
+		Limit:       logstore.DefaultSearchLimit,
+	})
+	s.alert = err
+	s.searched = err == nil
+}
+
+func (s *Search) render() {
+	view := searchUI.DeepCopy()
+
+	view.SetElementAttribute("search_query", "value", s.query)
+	view.SetElementAttribute("search_application", "value", s.application)
+	view.SetElementAttribute("search_goal", "value", s.goal)
+	view.SetElementAttribute("search_since", "value", s.since)
+
+	if s.alert != nil {
+		view.SetElementText("alert", s.alert.Error())
+	} else {
+		view.DeleteChild("alert")
+	}
+
+	switch {
+	case !s.searched:
+		view.DeleteChild("search_summary")
+	case s.truncated:
+		view.SetElementText("search_summary", fmt.Sprintf("Showing the first %d matching lines.", len(s.matches)))
+	default:
+		view.SetElementText("search_summary", fmt.Sprintf("%d matching lines.", len(s.matches)))
+	}
+
+	for _, match := range s.matches {
+		view.AppendChild("search_results", searchMatchView(match))
+	}
+
+	breadcrumbs := [][]string{{"Applications", "#/"}}
+	if s.ctx.Params["application"] != "" {
+		name := s.ctx.Params["application"]
+		breadcrumbs = append(breadcrumbs, []string{name, fmt.Sprintf("#/apps/%s", name)}, []string{"Search Logs", fmt.Sprintf("#/search/%s", name)})
+	} else {
+		breadcrumbs = append(breadcrumbs, []string{"Search Logs", "#/search"})
+	}
+
+	s.ctx.UpdateScreen(&reactor.DisplayUpdate{
+		Model: WithNavigation(view, breadcrumbs),
+	})
+}
+
+func (s *Search) Unmount() {}
+
+// searchMatchView shows the matching line highlighted between the lines
+// around it.
+func searchMatchView(match logstore.Match) *reactor.DisplayModel {
+	view := searchMatchUI.DeepCopy()
+
+	view.SetElementText("match_goal", fmt.Sprintf("%s / %s", match.Application, match.Goal))
+	view.SetElementAttribute("match_goal", "href", fmt.Sprintf("#/apps/%s/%s", match.Application, match.Goal))
+	view.SetElementText("match_run", fmt.Sprintf("container %s, %s", shortID(match.ContainerID), match.Line.Time.Local().Format("2006-01-02 15:04:05")))
+
+	for _, line := range match.Before {
+		view.AppendChild("match_lines", searchLineView(searchContextLineUI, line))
+	}
+	view.AppendChild("match_lines", searchLineView(searchMatchedLineUI, match.Line))
+	for _, line := range match.After {
+		view.AppendChild("match_lines", searchLineView(searchContextLineUI, line))
+	}
+
+	return view
+}
+
+func searchLineView(template *reactor.DisplayModel, line logstore.Line) *reactor.DisplayModel {
+	view := template.DeepCopy()
+	view.SetElementText("line", line.Text)
+	return view
+}
+
+var searchUI = reactor.MustParseDisplayModel(`
+	<div>
+		<bs.Panel header="Search Logs">
+			<bs.Alert id="alert" bsStyle="danger"/>
+			<form>
+				<bs.FormGroup controlId="searchQuery">
+					<bs.ControlLabel>Text</bs.ControlLabel>
+					<bs.FormControl id="search_query" type="text" reportEvents="change"/>
+				</bs.FormGroup>
+				<bs.FormGroup controlId="searchApplication">
+					<bs.ControlLabel>Application</bs.ControlLabel>
+					<bs.FormControl id="search_application" type="text" placeholder="all applications" reportEvents="change"/>
+				</bs.FormGroup>
+				<bs.FormGroup controlId="searchGoal">
+					<bs.ControlLabel>Goal</bs.ControlLabel>
+					<bs.FormControl id="search_goal" type="text" placeholder="all goals" reportEvents="change"/>
+				</bs.FormGroup>
+				<bs.FormGroup controlId="searchSince">
+					<bs.ControlLabel>Since</bs.ControlLabel>
+					<bs.FormControl id="search_since" type="text" placeholder="e.g. 1h or 2017-03-01T10:00:00Z" reportEvents="change"/>
+				</bs.FormGroup>
+				<bs.Button id="search_button" bsStyle="primary" reportEvents="click"><bs.Glyphicon glyph="search"/> Search</bs.Button>
+			</form>
+		</bs.Panel>
+		<p id="search_summary"/>
+		<div id="search_results"/>
+	</div>
+`)
+
+var searchMatchUI = reactor.MustParseDisplayModel(`
+	<bs.Panel>
+		<p><a id="match_goal" href="#"/> <small id="match_run"/></p>
+		<pre id="match_lines"/>
+	</bs.Panel>
+`)
+
+var searchContextLineUI = reactor.MustParseDisplayModel(`<span id="line"/>`)
+
+var searchMatchedLineUI = reactor.MustParseDisplayModel(`<strong id="line"/>`)